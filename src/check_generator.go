@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"go_automata/src/generator"
+	"go_automata/src/utils"
+)
+
+type QualitySettings struct {
+	Generator string
+	Samples   int
+	Seed      int
+	Alpha     float64
+}
+
+func DefaultQualitySettings() *QualitySettings {
+	return &QualitySettings{"", 1000000, 9000000, 0.001}
+}
+
+func (q *QualitySettings) Overrides() []utils.Override {
+	return []utils.Override{
+		{Key: "GENERATOR", Usage: "generator to check, all of them if empty", Value: &q.Generator},
+		{Key: "QUALITY_SAMPLES", Usage: "samples drawn by each test", Value: &q.Samples},
+		{Key: "QUALITY_SEED", Usage: "seed of the checked generators", Value: &q.Seed},
+		{Key: "QUALITY_ALPHA", Usage: "significance level of each test", Value: &q.Alpha},
+	}
+}
+
+// checkGenerators runs the statistical quality tests on the chosen
+// generator, or on every available generator if none was chosen, and reports
+// whether all of them passed.
+func checkGenerators(settings *QualitySettings) (bool, error) {
+	names := generator.Names()
+	if settings.Generator != "" {
+		names = []string{settings.Generator}
+	}
+
+	passed := true
+	for _, name := range names {
+		g, err := generator.New(name, uint64(settings.Seed))
+		if err != nil {
+			return false, err
+		}
+		fmt.Printf("Generator: %s (%d samples, seed %d, alpha %g)\n", name, settings.Samples, settings.Seed, settings.Alpha)
+		report := generator.CheckQuality(g, settings.Samples, settings.Alpha)
+		report.Print()
+		fmt.Println()
+		passed = passed && report.Passed()
+	}
+	return passed, nil
+}
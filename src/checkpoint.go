@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CheckpointEntry is a finished replication: the value of every metric, in
+// the order of metrics, and the conflicts of the compared configuration.
+type CheckpointEntry struct {
+	Config            uint64    `json:"config"`
+	Replication       uint64    `json:"replication"`
+	Seed              uint64    `json:"seed"`
+	Values            []float64 `json:"values"`
+	ComparedConflicts *int      `json:"compared_conflicts,omitempty"`
+}
+
+type checkpointHeader struct {
+	Fingerprint string   `json:"fingerprint"`
+	Metrics     []string `json:"metrics"`
+}
+
+// Checkpoint appends every finished replication of a sweep to a JSON Lines
+// file, so that a sweep that was interrupted can be resumed without running
+// them again. Its first line identifies the study it belongs to.
+type Checkpoint struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	done map[uint64]map[uint64]*CheckpointEntry
+}
+
+// studyFingerprint hashes the parameters that determine the outcome of every
+// replication, leaving out the ones that only decide how many there are or
+// how the results are written.
+func studyFingerprint(cfg *ScenarioConfig) (string, error) {
+	data, err := yaml.Marshal(struct {
+		Model          any `yaml:"model"`
+		Sweep          any `yaml:"sweep"`
+		Compare        any `yaml:"compare"`
+		SimulationTime int `yaml:"simulation_time"`
+		Generator      any `yaml:"generator"`
+		Antithetic     any `yaml:"antithetic"`
+	}{cfg.Model, cfg.Sweep, cfg.Compare, cfg.Replications.SimulationTime, cfg.Replications.Generator, cfg.Replications.Antithetic})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func metricNames() []string {
+	names := make([]string, len(metrics))
+	for k, metric := range metrics {
+		names[k] = metric.Name
+	}
+	return names
+}
+
+// OpenCheckpoint starts a new checkpoint at path or, when resuming, reads
+// the replications already finished in it and keeps appending to it.
+func OpenCheckpoint(path string, cfg *ScenarioConfig, resume bool) (*Checkpoint, error) {
+	fingerprint, err := studyFingerprint(cfg)
+	if err != nil {
+		return nil, err
+	}
+	header := checkpointHeader{fingerprint, metricNames()}
+	c := &Checkpoint{path: path, done: make(map[uint64]map[uint64]*CheckpointEntry)}
+
+	if resume {
+		size, err := c.load(header)
+		if err == nil {
+			return c, c.reopen(size)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	c.f, err = os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.append(header); err != nil {
+		c.f.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// load reads the checkpoint and returns the size of its complete lines.
+func (c *Checkpoint) load(header checkpointHeader) (int64, error) {
+	f, err := os.Open(c.path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64*1024*1024)
+	if !scanner.Scan() {
+		return 0, fmt.Errorf("%s: empty checkpoint", c.path)
+	}
+	var found checkpointHeader
+	if err := json.Unmarshal(scanner.Bytes(), &found); err != nil {
+		return 0, fmt.Errorf("%s: %w", c.path, err)
+	}
+	if found.Fingerprint != header.Fingerprint || !slices.Equal(found.Metrics, header.Metrics) {
+		return 0, fmt.Errorf("%s was written by a different study", c.path)
+	}
+	size := int64(len(scanner.Bytes()) + 1)
+	for scanner.Scan() {
+		entry := &CheckpointEntry{}
+		// A line cut short by the interruption is simply run again.
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			break
+		}
+		size += int64(len(scanner.Bytes()) + 1)
+		if c.done[entry.Config] == nil {
+			c.done[entry.Config] = make(map[uint64]*CheckpointEntry)
+		}
+		c.done[entry.Config][entry.Replication] = entry
+	}
+	return size, scanner.Err()
+}
+
+// reopen drops whatever was left after the last complete entry, ending it
+// with a newline if the interruption left it without one, and keeps
+// appending after it.
+func (c *Checkpoint) reopen(size int64) error {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return err
+	}
+	if err := os.Truncate(c.path, min(size, info.Size())); err != nil {
+		return err
+	}
+	c.f, err = os.OpenFile(c.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err == nil && size > info.Size() {
+		_, err = c.f.Write([]byte{'\n'})
+	}
+	return err
+}
+
+func (c *Checkpoint) append(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = c.f.Write(append(data, '\n'))
+	return err
+}
+
+// Done returns the replications of the given configuration found in the
+// checkpoint when it was opened.
+func (c *Checkpoint) Done(config uint64) map[uint64]*CheckpointEntry {
+	return c.done[config]
+}
+
+// Finished returns how many replications the checkpoint already had.
+func (c *Checkpoint) Finished() int {
+	total := 0
+	for _, replications := range c.done {
+		total += len(replications)
+	}
+	return total
+}
+
+func (c *Checkpoint) Record(entry *CheckpointEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.append(entry)
+}
+
+func (c *Checkpoint) Close() error {
+	return c.f.Close()
+}
+
+// Remove deletes the checkpoint once the results it was protecting are
+// saved.
+func (c *Checkpoint) Remove() error {
+	c.Close()
+	return os.Remove(c.path)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"go_automata/src/generator"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeCheckpoint runs the first configuration of the scenario's sweep into
+// a new checkpoint and returns its input and result.
+func writeCheckpoint(t *testing.T, cfg *ScenarioConfig, path string) (Input, *Result) {
+	t.Helper()
+	sweep, err := NewSweep(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := Input{i: 0, config: sweep.Configs()[0]}
+	checkpoint, err := OpenCheckpoint(path, cfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checkpoint.Close()
+	result, err := simulateConfiguration(context.Background(), cfg, input, testFactory(t, cfg), checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input, result
+}
+
+func testFactory(t *testing.T, cfg *ScenarioConfig) generator.Factory {
+	t.Helper()
+	factory, err := generator.Lookup(cfg.Replications.Generator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return factory
+}
+
+// readCheckpointEntries reads the entries of a checkpoint, failing on any
+// line that is not a complete entry.
+func readCheckpointEntries(t *testing.T, path string) []*CheckpointEntry {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), "\n") {
+		t.Fatalf("%s does not end with a newline", path)
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	scanner.Scan()
+	var entries []*CheckpointEntry
+	for scanner.Scan() {
+		entry := &CheckpointEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			t.Fatalf("%s: line %q: %v", path, scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func replications(entries []*CheckpointEntry) []uint64 {
+	var js []uint64
+	for _, entry := range entries {
+		js = append(js, entry.Replication)
+	}
+	return js
+}
+
+// A sweep interrupted while writing its last replication resumes with the
+// replications before it and runs only that one again.
+func TestCheckpointResumeSkipsFinishedReplications(t *testing.T) {
+	cfg := testScenario()
+	path := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	input, want := writeCheckpoint(t, cfg, path)
+	written := readCheckpointEntries(t, path)
+	if got := replications(written); !reflect.DeepEqual(got, []uint64{0, 1, 2}) {
+		t.Fatalf("checkpoint holds replications %v, want [0 1 2]", got)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, info.Size()-10); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint, err := OpenCheckpoint(path, cfg, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checkpoint.Close()
+	if checkpoint.Finished() != 2 {
+		t.Fatalf("resumed with %d finished replications, want 2", checkpoint.Finished())
+	}
+	input.done = checkpoint.Done(0)
+	for j := uint64(0); j < 2; j++ {
+		if !reflect.DeepEqual(input.done[j], written[j]) {
+			t.Errorf("replication %d resumed as %+v, want %+v", j, input.done[j], written[j])
+		}
+	}
+
+	got, err := simulateConfiguration(context.Background(), cfg, input, testFactory(t, cfg), checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Runs != want.Runs || !reflect.DeepEqual(got.Seeds, want.Seeds) || !reflect.DeepEqual(got.Replications, want.Replications) {
+		t.Errorf("resumed result %d runs %v, want %d runs %v", got.Runs, got.Replications, want.Runs, want.Replications)
+	}
+	if got := replications(readCheckpointEntries(t, path)); !reflect.DeepEqual(got, []uint64{0, 1, 2}) {
+		t.Errorf("resumed checkpoint holds replications %v, want [0 1 2] with only the cut one run again", got)
+	}
+}
+
+// A sweep interrupted right before the newline of its last replication
+// keeps it, and appends the next entry on a line of its own.
+func TestCheckpointResumeRepairsMissingNewline(t *testing.T) {
+	cfg := testScenario()
+	path := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	writeCheckpoint(t, cfg, path)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, info.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint, err := OpenCheckpoint(path, cfg, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint.Finished() != 3 {
+		t.Fatalf("resumed with %d finished replications, want 3", checkpoint.Finished())
+	}
+	if err := checkpoint.Record(&CheckpointEntry{Config: 1, Replication: 0, Seed: seedBase + seedsPerConfiguration}); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkpoint.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := replications(readCheckpointEntries(t, path)); !reflect.DeepEqual(got, []uint64{0, 1, 2, 0}) {
+		t.Errorf("repaired checkpoint holds replications %v, want [0 1 2 0]", got)
+	}
+}
+
+// Resuming is refused when the checkpoint belongs to a study whose
+// replications would come out differently, but not when the study only asks
+// for more of them.
+func TestCheckpointResumeChecksFingerprint(t *testing.T) {
+	cfg := testScenario()
+	path := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	writeCheckpoint(t, cfg, path)
+
+	tests := []struct {
+		name   string
+		change func(cfg *ScenarioConfig)
+		reject bool
+	}{
+		{"simulation time", func(cfg *ScenarioConfig) { cfg.Replications.SimulationTime++ }, true},
+		{"generator", func(cfg *ScenarioConfig) { cfg.Replications.Generator = "pcg" }, true},
+		{"model", func(cfg *ScenarioConfig) { cfg.Model.Signal.GreenLightTime++ }, true},
+		{"runs per simulation", func(cfg *ScenarioConfig) { cfg.Replications.RunsPerSimulation++ }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := testScenario()
+			tt.change(changed)
+			checkpoint, err := OpenCheckpoint(path, changed, true)
+			if !tt.reject {
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkpoint.Close()
+				return
+			}
+			if err == nil {
+				checkpoint.Close()
+				t.Fatal("resumed a checkpoint written by a different study")
+			}
+			if !strings.Contains(err.Error(), "different study") {
+				t.Errorf("got error %q, want a different study", err)
+			}
+		})
+	}
+	if got := replications(readCheckpointEntries(t, path)); !reflect.DeepEqual(got, []uint64{0, 1, 2}) {
+		t.Errorf("checkpoint holds replications %v after the refused resumes, want [0 1 2]", got)
+	}
+}
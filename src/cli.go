@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"go_automata/src/utils"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Command struct {
+	Name        string
+	Description string
+	Run         func(ctx context.Context, args []string) error
+}
+
+func commands() []*Command {
+	return []*Command{
+		{"run", "simulate a single configuration showing the grid on every epoch", runCommand},
+		{"sweep", "simulate every configuration of the sweep and save the results", sweepCommand},
+		{"replay", "rewind a run to an epoch and replay it from there", replayCommand},
+		{"fork", "fork a run at an epoch, change the fork and compare how both go on", forkCommand},
+		{"diff-snapshots", "list the agents added, removed or moved between two snapshots", diffSnapshotsCommand},
+		{"resume", "continue an interrupted sweep from its manifest", resumeCommand},
+		{"worker", "simulate configurations leased from a 'sweep -listen' coordinator", workerCommand},
+		{"reproduce", "re-run a sweep from its manifest and compare the results", reproduceCommand},
+		{"visualize", "plot a results file as a heatmap", visualizeCommand},
+		{"validate-config", "check the configuration and report every error", validateConfigCommand},
+		{"describe", "print the resolved configuration", describeCommand},
+		{"check-generator", "run the statistical quality tests on the generators", checkGeneratorCommand},
+	}
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands() {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", cmd.Name, cmd.Description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' to list the flags of a command.\n", os.Args[0])
+}
+
+// runCLI dispatches to the command named in args, defaulting to sweep so
+// that running the binary without arguments keeps doing what it always did.
+func runCLI(ctx context.Context, args []string) error {
+	name := "sweep"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		printUsage()
+		return nil
+	}
+	for _, cmd := range commands() {
+		if cmd.Name == name {
+			return cmd.Run(ctx, args)
+		}
+	}
+	printUsage()
+	return fmt.Errorf("unknown command %q", name)
+}
+
+// ConfigErrors groups every problem found in a configuration, so they can be
+// reported one per line.
+type ConfigErrors []error
+
+func (e ConfigErrors) Error() string {
+	return errors.Join(e...).Error()
+}
+
+func flagName(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
+
+// bindOverrides defines a flag for every override. The flags only record the
+// values they were given, which take precedence over the environment once
+// looked up through lookup.
+func bindOverrides(fs *flag.FlagSet, overrides []utils.Override, values map[string]string) {
+	for _, o := range overrides {
+		key := o.Key
+		usage := fmt.Sprintf("%s (env %s)", o.Usage, key)
+		_, isBool := o.Value.(*bool)
+		fs.Var(&overrideFlag{key, values, isBool}, flagName(key), usage)
+	}
+}
+
+// overrideFlag records the value given to the flag of an override. The flag
+// of a boolean override can be given bare, as in -antithetic.
+type overrideFlag struct {
+	key    string
+	values map[string]string
+	isBool bool
+}
+
+func (f *overrideFlag) String() string {
+	return f.values[f.key]
+}
+
+func (f *overrideFlag) Set(v string) error {
+	f.values[f.key] = v
+	return nil
+}
+
+func (f *overrideFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+func flagsThenEnv(values map[string]string) utils.Lookup {
+	return func(key string) (string, bool) {
+		if v, ok := values[key]; ok {
+			return v, true
+		}
+		return os.LookupEnv(key)
+	}
+}
+
+type ScenarioFlags struct {
+	scenarioFile string
+	values       map[string]string
+}
+
+// addScenarioFlags defines the -scenario flag plus one flag per scenario
+// field (e.g. -green-light-time) and per compared model field (e.g.
+// -compare-green-light-time).
+func addScenarioFlags(fs *flag.FlagSet) *ScenarioFlags {
+	sf := &ScenarioFlags{values: make(map[string]string)}
+	fs.StringVar(&sf.scenarioFile, "scenario", os.Getenv("SCENARIO_FILE"), "scenario file, YAML or JSON (env SCENARIO_FILE)")
+
+	defaults := DefaultScenarioConfig()
+	bindOverrides(fs, defaults.Overrides(), sf.values)
+	compared := defaults.Model.Overrides()
+	for i := range compared {
+		compared[i].Key = "COMPARE_" + compared[i].Key
+		compared[i].Usage = "compared " + compared[i].Usage
+	}
+	bindOverrides(fs, compared, sf.values)
+	return sf
+}
+
+func (sf *ScenarioFlags) Load() (*ScenarioConfig, error) {
+	s, err := LoadScenarioConfig(sf.scenarioFile, flagsThenEnv(sf.values))
+	if err != nil {
+		return nil, ConfigErrors{err}
+	}
+	if errs := s.Validate(); len(errs) > 0 {
+		return nil, ConfigErrors(errs)
+	}
+	return s, nil
+}
+
+func sweepCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	sf := addScenarioFlags(fs)
+	cf := addCoordinatorFlags(fs)
+	fs.Parse(args)
+
+	scenarioCfg, err := sf.Load()
+	if err != nil {
+		return err
+	}
+	_, err = runSweep(ctx, NewManifest(scenarioCfg), false, cf)
+	return err
+}
+
+func resumeCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("resume", flag.ExitOnError)
+	manifestPath := fs.String("manifest", "", "manifest of the interrupted sweep")
+	goroutines := fs.Int("goroutines", 0, "number of worker goroutines, by default the manifest's")
+	cf := addCoordinatorFlags(fs)
+	fs.Parse(args)
+	if *manifestPath == "" {
+		return errors.New("resume needs a -manifest")
+	}
+
+	manifest, err := LoadManifest(*manifestPath)
+	if err != nil {
+		return err
+	}
+	if !manifest.FinishedAt.IsZero() {
+		return fmt.Errorf("the sweep of %s already finished", *manifestPath)
+	}
+	if errs := manifest.Scenario.Validate(); len(errs) > 0 {
+		return ConfigErrors(errs)
+	}
+	if *goroutines > 0 {
+		manifest.Scenario.Outputs.Goroutines = *goroutines
+	}
+	manifest.ResumedAt = append(manifest.ResumedAt, time.Now())
+	_, err = runSweep(ctx, manifest, true, cf)
+	return err
+}
+
+func validateConfigCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("validate-config", flag.ExitOnError)
+	sf := addScenarioFlags(fs)
+	fs.Parse(args)
+
+	if _, err := sf.Load(); err != nil {
+		return err
+	}
+	fmt.Println("Configuration is valid")
+	return nil
+}
+
+func describeCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("describe", flag.ExitOnError)
+	sf := addScenarioFlags(fs)
+	fs.Parse(args)
+
+	scenarioCfg, err := sf.Load()
+	if err != nil {
+		return err
+	}
+	out, err := yaml.Marshal(scenarioCfg)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(out))
+
+	config := scenarioCfg.Model.Build()
+	fmt.Println()
+	fmt.Printf("# Grid: %d rows x %d columns\n", config.TotalRows(), config.TotalCols())
+	fmt.Printf("# Crosswalk: %.1f x %.1f meters\n", float64(config.CrosswalkProt.Rows())/2, float64(config.CrosswalkProt.Cols())/2)
+	fmt.Printf("# Vehicle lanes: %d of %d columns\n", config.CrosswalkProt.Cols()/config.VehicleLaneProt.Cols(), config.VehicleLaneProt.Cols())
+	fmt.Printf("# Red light time: %d seconds\n", config.StopLightCycle-config.GreenLightTime)
+	return nil
+}
+
+func checkGeneratorCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("check-generator", flag.ExitOnError)
+	settings := DefaultQualitySettings()
+	values := make(map[string]string)
+	bindOverrides(fs, settings.Overrides(), values)
+	fs.Parse(args)
+
+	if err := utils.ApplyOverrides(settings.Overrides(), flagsThenEnv(values)); err != nil {
+		return ConfigErrors{err}
+	}
+	passed, err := checkGenerators(settings)
+	if err != nil {
+		return err
+	}
+	if !passed {
+		return errors.New("some generator failed the quality tests")
+	}
+	return nil
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go_automata/src/generator"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A coordinator hands the configurations of a sweep out to worker processes
+// over HTTP:
+//
+//	GET  /setup                       the scenario and the build of the coordinator
+//	POST /leases                      lease a configuration: 200 with a Lease,
+//	                                  204 if none is free yet, 410 once the sweep is over
+//	POST /leases/{id}/heartbeat       keep the lease
+//	POST /leases/{id}/replications    record a finished replication (a CheckpointEntry)
+//	POST /leases/{id}/done            hand the configuration back (a LeaseDone)
+//
+// Every request on a lease renews it, and a lease that went without any for
+// longer than the lease timeout is given to another worker, keeping the
+// replications already recorded. Calls on a lease that was lost answer 409.
+
+// CoordinatorFlags configure a sweep whose configurations are simulated by
+// worker processes instead of goroutines of this one.
+type CoordinatorFlags struct {
+	listen       string
+	leaseTimeout time.Duration
+	maxAttempts  int
+}
+
+func addCoordinatorFlags(fs *flag.FlagSet) *CoordinatorFlags {
+	cf := &CoordinatorFlags{}
+	fs.StringVar(&cf.listen, "listen", "", "serve the configurations to 'worker' processes at this address (e.g. :8080) instead of simulating them here")
+	fs.DurationVar(&cf.leaseTimeout, "lease-timeout", 30*time.Second, "time without news from a worker after which its configuration is given to another one")
+	fs.IntVar(&cf.maxAttempts, "max-attempts", 3, "leases of a configuration before it is abandoned")
+	return cf
+}
+
+// finishGrace is how long the coordinator keeps answering once the sweep is
+// over, so that polling workers learn about it instead of losing it.
+const finishGrace = 2 * workerPollInterval
+
+// WorkerSetup is what a worker needs to simulate the configurations of the
+// sweep: its scenario, and the build of the coordinator to warn about
+// workers that would compute different results.
+type WorkerSetup struct {
+	Scenario *ScenarioConfig `yaml:"scenario"`
+	Build    BuildInfo       `yaml:"build"`
+}
+
+// Lease gives a worker a configuration, by its index in the sweep, along
+// with the replications already done.
+type Lease struct {
+	ID               string             `json:"id"`
+	Index            uint64             `json:"index"`
+	Done             []*CheckpointEntry `json:"done"`
+	HeartbeatSeconds float64            `json:"heartbeat_seconds"`
+}
+
+// LeaseDone tells the coordinator that the configuration of a lease is
+// finished, or why it failed.
+type LeaseDone struct {
+	Error string `json:"error,omitempty"`
+}
+
+type job struct {
+	input    Input
+	attempts int
+}
+
+type lease struct {
+	job     *job
+	started time.Time
+	expires time.Time
+}
+
+type Coordinator struct {
+	cfg          *ScenarioConfig
+	flags        *CoordinatorFlags
+	recorder     ReplicationRecorder
+	newGenerator generator.Factory
+	inputCh      chan Input
+	resultsCh    chan *Result
+	server       *http.Server
+	finished     chan struct{}
+	finishOnce   sync.Once
+
+	mu           sync.Mutex
+	retries      []*job
+	leases       map[string]*lease
+	leased       uint64
+	inputsClosed bool
+	// summarizing counts the configurations handed back whose result is not
+	// sent yet.
+	summarizing int
+}
+
+// serveJobs starts a coordinator on the address of the flags. It takes the
+// configurations from inputCh and sends their results to resultsCh, as the
+// local workers do, and stops serving once ctx is done or shortly after the
+// sweep is over, which the returned wait group tells.
+func serveJobs(ctx context.Context, flags *CoordinatorFlags, cfg *ScenarioConfig, recorder ReplicationRecorder, inputCh chan Input, resultsCh chan *Result) (*sync.WaitGroup, error) {
+	c, err := NewCoordinator(flags, cfg, recorder, inputCh, resultsCh)
+	if err != nil {
+		return nil, err
+	}
+	c.server = &http.Server{Handler: c.Handler()}
+
+	listener, err := net.Listen("tcp", flags.listen)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Serving the configurations to workers at %s\n", listener.Addr())
+
+	stopped := &sync.WaitGroup{}
+	stopped.Add(1)
+	go c.server.Serve(listener)
+	go func() {
+		defer stopped.Done()
+		select {
+		case <-ctx.Done():
+		case <-c.finished:
+			time.Sleep(finishGrace)
+		}
+		// Shutdown waits for the requests in flight, so nothing is recorded
+		// after it returns.
+		c.server.Shutdown(context.Background())
+	}()
+	return stopped, nil
+}
+
+func NewCoordinator(flags *CoordinatorFlags, cfg *ScenarioConfig, recorder ReplicationRecorder, inputCh chan Input, resultsCh chan *Result) (*Coordinator, error) {
+	if flags.leaseTimeout <= 0 || flags.maxAttempts <= 0 {
+		return nil, fmt.Errorf("the lease timeout and max attempts must be positive")
+	}
+	newGenerator, err := generator.Lookup(cfg.Replications.Generator)
+	if err != nil {
+		return nil, err
+	}
+	return &Coordinator{
+		cfg:          cfg,
+		flags:        flags,
+		recorder:     recorder,
+		newGenerator: newGenerator,
+		inputCh:      inputCh,
+		resultsCh:    resultsCh,
+		finished:     make(chan struct{}),
+		leases:       make(map[string]*lease),
+	}, nil
+}
+
+// Handler serves the API of the coordinator.
+func (c *Coordinator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /setup", c.handleSetup)
+	mux.HandleFunc("POST /leases", c.handleLease)
+	mux.HandleFunc("POST /leases/{id}/heartbeat", c.handleHeartbeat)
+	mux.HandleFunc("POST /leases/{id}/replications", c.handleReplication)
+	mux.HandleFunc("POST /leases/{id}/done", c.handleDone)
+	return mux
+}
+
+// expire takes back the leases that timed out, abandoning the configurations
+// that were leased too many times already. Like handleDone, it sends the
+// abandoned configurations without mu held, so that a full results channel
+// holds up no other worker. It must be called without mu held.
+func (c *Coordinator) expire(now time.Time) {
+	c.mu.Lock()
+	var abandoned []*Result
+	for id, l := range c.leases {
+		if now.Before(l.expires) {
+			continue
+		}
+		delete(c.leases, id)
+		fmt.Printf("Lease %s of configuration %d expired\n", id, l.job.input.i)
+		if l.job.attempts >= c.flags.maxAttempts {
+			err := fmt.Errorf("leased %d times without finishing", l.job.attempts)
+			abandoned = append(abandoned, &Result{Index: l.job.input.i, Err: err})
+		} else {
+			c.retries = append(c.retries, l.job)
+		}
+	}
+	c.summarizing += len(abandoned)
+	c.mu.Unlock()
+
+	for _, result := range abandoned {
+		c.resultsCh <- result
+	}
+
+	c.mu.Lock()
+	c.summarizing -= len(abandoned)
+	c.checkFinished()
+	c.mu.Unlock()
+}
+
+// checkFinished tells the coordinator to stop once every configuration was
+// handed back. It must be called with mu held.
+func (c *Coordinator) checkFinished() {
+	if c.inputsClosed && len(c.retries) == 0 && len(c.leases) == 0 && c.summarizing == 0 {
+		c.finishOnce.Do(func() { close(c.finished) })
+	}
+}
+
+// next returns the next configuration to lease, if any. It must be called
+// with mu held.
+func (c *Coordinator) next() *job {
+	if len(c.retries) > 0 {
+		j := c.retries[0]
+		c.retries = c.retries[1:]
+		return j
+	}
+	if c.inputsClosed {
+		return nil
+	}
+	select {
+	case input, ok := <-c.inputCh:
+		if ok {
+			return &job{input: input}
+		}
+		c.inputsClosed = true
+	default:
+	}
+	return nil
+}
+
+// lease finds the lease of a request and renews it, answering 409 if it was
+// lost. It must be called with mu held, after expire.
+func (c *Coordinator) lease(w http.ResponseWriter, r *http.Request) *lease {
+	now := time.Now()
+	l, ok := c.leases[r.PathValue("id")]
+	// A lease that ran out since expire is lost all the same.
+	if !ok || !now.Before(l.expires) {
+		http.Error(w, "lease lost", http.StatusConflict)
+		return nil
+	}
+	l.expires = now.Add(c.flags.leaseTimeout)
+	return l
+}
+
+func (c *Coordinator) handleSetup(w http.ResponseWriter, r *http.Request) {
+	data, err := yaml.Marshal(WorkerSetup{c.cfg, readBuildInfo()})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(data)
+}
+
+func (c *Coordinator) handleLease(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	c.expire(now)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	j := c.next()
+	if j == nil {
+		c.checkFinished()
+		select {
+		case <-c.finished:
+			w.WriteHeader(http.StatusGone)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+	j.attempts++
+	c.leased++
+	id := fmt.Sprintf("%d-%d", j.input.i, c.leased)
+	c.leases[id] = &lease{job: j, started: now, expires: now.Add(c.flags.leaseTimeout)}
+
+	l := Lease{ID: id, Index: j.input.i, HeartbeatSeconds: c.flags.leaseTimeout.Seconds() / 3}
+	for _, entry := range j.input.done {
+		l.Done = append(l.Done, entry)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l)
+}
+
+func (c *Coordinator) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	c.expire(time.Now())
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lease(w, r) != nil {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (c *Coordinator) handleReplication(w http.ResponseWriter, r *http.Request) {
+	entry := &CheckpointEntry{}
+	if err := json.NewDecoder(r.Body).Decode(entry); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.expire(time.Now())
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l := c.lease(w, r)
+	if l == nil {
+		return
+	}
+	if entry.Config != l.job.input.i {
+		http.Error(w, fmt.Sprintf("the lease is for configuration %d, not %d", l.job.input.i, entry.Config), http.StatusBadRequest)
+		return
+	}
+	if err := c.recorder.Record(entry); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if l.job.input.done == nil {
+		l.job.input.done = make(map[uint64]*CheckpointEntry)
+	}
+	l.job.input.done[entry.Replication] = entry
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDone summarizes a configuration from the replications its workers
+// recorded, which gives the same result as simulating it here. The summary
+// runs without mu held, so that it holds up no other worker.
+func (c *Coordinator) handleDone(w http.ResponseWriter, r *http.Request) {
+	var done LeaseDone
+	if err := json.NewDecoder(r.Body).Decode(&done); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.expire(time.Now())
+	c.mu.Lock()
+	l := c.lease(w, r)
+	if l == nil {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.leases, r.PathValue("id"))
+	c.summarizing++
+	c.mu.Unlock()
+
+	input := l.job.input
+	var result *Result
+	if done.Error != "" {
+		result = &Result{Index: input.i, Err: errors.New(done.Error)}
+	} else {
+		var err error
+		result, err = simulateConfiguration(r.Context(), c.cfg, input, c.newGenerator, c.recorder)
+		if err != nil {
+			result = &Result{Index: input.i, Err: err}
+		}
+		result.StartedAt = l.started
+		result.Duration = time.Since(l.started)
+	}
+	c.resultsCh <- result
+
+	c.mu.Lock()
+	c.summarizing--
+	c.checkFinished()
+	c.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
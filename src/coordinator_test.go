@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"go_automata/src/generator"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryRecorder keeps the replications it records.
+type memoryRecorder struct {
+	mu      sync.Mutex
+	entries []*CheckpointEntry
+}
+
+func (m *memoryRecorder) Record(entry *CheckpointEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func testScenario() *ScenarioConfig {
+	cfg := DefaultScenarioConfig()
+	cfg.Sweep.PointsPerAxis = 2
+	cfg.Replications.RunsPerSimulation = 3
+	cfg.Replications.SimulationTime = 120
+	return cfg
+}
+
+// startCoordinator serves the first configuration of the scenario's sweep
+// with the given lease timeout and max attempts.
+func startCoordinator(t *testing.T, cfg *ScenarioConfig, leaseTimeout time.Duration, maxAttempts int) (*CoordinatorClient, Input, chan *Result) {
+	t.Helper()
+	sweep, err := NewSweep(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := Input{i: 0, config: sweep.Configs()[0]}
+	inputCh := make(chan Input, 1)
+	inputCh <- input
+	close(inputCh)
+	resultsCh := make(chan *Result, 1)
+
+	flags := &CoordinatorFlags{leaseTimeout: leaseTimeout, maxAttempts: maxAttempts}
+	c, err := NewCoordinator(flags, cfg, &memoryRecorder{}, inputCh, resultsCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(c.Handler())
+	t.Cleanup(server.Close)
+	return NewCoordinatorClient(server.URL), input, resultsCh
+}
+
+func TestCoordinatorReissuesExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	cfg := testScenario()
+	client, input, resultsCh := startCoordinator(t, cfg, 100*time.Millisecond, 3)
+
+	first, err := client.Lease(ctx)
+	if err != nil || first == nil {
+		t.Fatalf("first lease: %v, %v", first, err)
+	}
+	newGenerator, err := generator.Lookup(cfg.Replications.Generator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := replicate(ctx, cfg, input, 0, newGenerator, &leaseRecorder{ctx, client, first.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The worker goes silent and its lease expires.
+	time.Sleep(200 * time.Millisecond)
+	if err := client.post(ctx, first.ID, "heartbeat", nil); !errors.Is(err, errLeaseLost) {
+		t.Fatalf("heartbeat on an expired lease: got %v, want %v", err, errLeaseLost)
+	}
+
+	second, err := client.Lease(ctx)
+	if err != nil || second == nil {
+		t.Fatalf("second lease: %v, %v", second, err)
+	}
+	if second.ID == first.ID || second.Index != first.Index {
+		t.Fatalf("re-issued lease %s of configuration %d, want a new lease of configuration %d", second.ID, second.Index, first.Index)
+	}
+	if len(second.Done) != 1 || !reflect.DeepEqual(second.Done[0], recorded) {
+		t.Fatalf("re-issued lease carries %v, want the replication recorded on the first one", second.Done)
+	}
+
+	worker, err := NewWorker(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := worker.simulate(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	result := <-resultsCh
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+
+	local, err := simulateConfiguration(ctx, cfg, input, newGenerator, &memoryRecorder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Runs != local.Runs || !reflect.DeepEqual(result.Metrics, local.Metrics) || !reflect.DeepEqual(result.Seeds, local.Seeds) {
+		t.Errorf("distributed result %d runs %v, want %d runs %v as simulated here", result.Runs, result.Metrics, local.Runs, local.Metrics)
+	}
+
+	if _, err := client.Lease(ctx); !errors.Is(err, errSweepOver) {
+		t.Errorf("lease after the sweep: got %v, want %v", err, errSweepOver)
+	}
+}
+
+func TestCoordinatorAbandonsConfigurationAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	client, _, resultsCh := startCoordinator(t, testScenario(), 50*time.Millisecond, 2)
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		l, err := client.Lease(ctx)
+		if err != nil || l == nil {
+			t.Fatalf("lease %d: %v, %v", attempt, l, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if _, err := client.Lease(ctx); !errors.Is(err, errSweepOver) {
+		t.Errorf("lease after the last attempt expired: got %v, want %v", err, errSweepOver)
+	}
+	select {
+	case result := <-resultsCh:
+		if result.Index != 0 || result.Err == nil {
+			t.Errorf("got result %+v, want configuration 0 abandoned", result)
+		}
+	default:
+		t.Error("the abandoned configuration sent no result")
+	}
+}
@@ -0,0 +1,39 @@
+package generator
+
+import "math"
+
+// Antithetic mirrors every uniform drawn from the wrapped generator (u -> 1-u),
+// so a replication using it is negatively correlated with the replication
+// that uses the wrapped generator directly.
+type Antithetic struct {
+	sampler
+	g Generator
+}
+
+func NewAntithetic(g Generator) *Antithetic {
+	a := &Antithetic{g: g}
+	a.sampler = sampler{a}
+	return a
+}
+
+func (a *Antithetic) Random() float64 {
+	u := 1 - a.g.Random()
+	if u >= 1 {
+		return math.Nextafter(1, 0)
+	}
+	return u
+}
+
+func AntitheticFactory(factory Factory) Factory {
+	return func(seed uint64) Generator {
+		return NewAntithetic(factory(seed))
+	}
+}
+
+func (a *Antithetic) Save() []byte {
+	return a.g.Save()
+}
+
+func (a *Antithetic) Restore(state []byte) error {
+	return a.g.Restore(state)
+}
@@ -1,21 +1,33 @@
 package generator
 
 import (
-	"math"
+	"encoding/binary"
+	"fmt"
+	"sync"
 
 	"lukechampine.com/uint128"
 )
 
 type BlumBlumShub struct {
+	sampler
 	curr uint64
 	m    uint64
 }
 
+var (
+	bbsModulusOnce sync.Once
+	bbsModulus     uint64
+)
+
 func NewBlumBlumShub(seed uint64) *BlumBlumShub {
-	p := nextUsablePrime(800000000)
-	q := nextUsablePrime(400000000)
-	m := p * q
-	return &BlumBlumShub{seed, m}
+	bbsModulusOnce.Do(func() {
+		p := nextUsablePrime(800000000)
+		q := nextUsablePrime(400000000)
+		bbsModulus = p * q
+	})
+	bbs := &BlumBlumShub{curr: seed, m: bbsModulus}
+	bbs.sampler = sampler{bbs}
+	return bbs
 }
 
 func (bbs *BlumBlumShub) next() float64 {
@@ -59,25 +71,18 @@ func (bbs *BlumBlumShub) Random() float64 {
 	return bbs.next()
 }
 
-// / Returns a random integer in the range [a, b)
-func (bbs *BlumBlumShub) RandInt(a int, b int) int {
-	p := (float64(b-a))*bbs.Random() + float64(a)
-	return int(p)
+func (bbs *BlumBlumShub) Save() []byte {
+	state := make([]byte, 16)
+	binary.LittleEndian.PutUint64(state[0:], bbs.curr)
+	binary.LittleEndian.PutUint64(state[8:], bbs.m)
+	return state
 }
 
-func (bbs *BlumBlumShub) Poi(lambda float64) int {
-	L := math.Exp(-lambda)
-	k := 0
-	p := 1.0
-	for p > L {
-		k++
-		v := bbs.Random()
-		p *= v
+func (bbs *BlumBlumShub) Restore(state []byte) error {
+	if len(state) != 16 {
+		return fmt.Errorf("invalid BlumBlumShub state length %d", len(state))
 	}
-	return k - 1
-}
-
-func (bbs *BlumBlumShub) Choice(a []any) int {
-	i := bbs.RandInt(0, len(a))
-	return i
+	bbs.curr = binary.LittleEndian.Uint64(state[0:])
+	bbs.m = binary.LittleEndian.Uint64(state[8:])
+	return nil
 }
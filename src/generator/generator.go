@@ -1,7 +1,53 @@
 package generator
 
+import (
+	"fmt"
+	"sort"
+)
+
 type Generator interface {
 	Random() float64
 	RandInt(a int, b int) int
 	Poi(l float64) int
+	Binomial(n int, p float64) int
+	NegBinomial(r float64, p float64) int
+	Normal() float64
+	Save() []byte
+	Restore(state []byte) error
+}
+
+type Factory func(seed uint64) Generator
+
+const DefaultName = "bbs"
+
+var factories = map[string]Factory{
+	"bbs":      func(seed uint64) Generator { return NewBlumBlumShub(seed) },
+	"pcg":      func(seed uint64) Generator { return NewPCG(seed) },
+	"xoshiro":  func(seed uint64) Generator { return NewXoshiro256(seed) },
+	"mathrand": func(seed uint64) Generator { return NewMathRand(seed) },
+}
+
+func Lookup(name string) (Factory, error) {
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown generator %q (available: %v)", name, Names())
+	}
+	return factory, nil
+}
+
+func New(name string, seed uint64) (Generator, error) {
+	factory, err := Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return factory(seed), nil
+}
+
+func Names() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
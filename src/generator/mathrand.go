@@ -0,0 +1,38 @@
+package generator
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+)
+
+// MathRand adapts the standard library's math/rand/v2 generator (ChaCha8).
+type MathRand struct {
+	sampler
+	src *rand.ChaCha8
+	r   *rand.Rand
+}
+
+func NewMathRand(seed uint64) *MathRand {
+	var key [32]byte
+	binary.LittleEndian.PutUint64(key[:], seed)
+	src := rand.NewChaCha8(key)
+	mr := &MathRand{src: src, r: rand.New(src)}
+	mr.sampler = sampler{mr}
+	return mr
+}
+
+func (mr *MathRand) Random() float64 {
+	return mr.r.Float64()
+}
+
+func (mr *MathRand) Save() []byte {
+	state, err := mr.src.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	return state
+}
+
+func (mr *MathRand) Restore(state []byte) error {
+	return mr.src.UnmarshalBinary(state)
+}
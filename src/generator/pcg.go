@@ -0,0 +1,32 @@
+package generator
+
+import "math/rand/v2"
+
+const pcgStream = 0xda3e39cb94b95bdb
+
+type PCG struct {
+	sampler
+	src *rand.PCG
+}
+
+func NewPCG(seed uint64) *PCG {
+	pcg := &PCG{src: rand.NewPCG(seed, pcgStream)}
+	pcg.sampler = sampler{pcg}
+	return pcg
+}
+
+func (pcg *PCG) Random() float64 {
+	return uint64ToFloat(pcg.src.Uint64())
+}
+
+func (pcg *PCG) Save() []byte {
+	state, err := pcg.src.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	return state
+}
+
+func (pcg *PCG) Restore(state []byte) error {
+	return pcg.src.UnmarshalBinary(state)
+}
@@ -0,0 +1,233 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+type QualityResult struct {
+	Name      string
+	Statistic float64
+	PValue    float64
+	Passed    bool
+}
+
+type QualityReport struct {
+	Samples int
+	Alpha   float64
+	Results []QualityResult
+}
+
+// CheckQuality runs a battery of statistical tests on the generator, each
+// with the given amount of samples. A test fails when its p-value is below
+// alpha.
+func CheckQuality(g Generator, samples int, alpha float64) *QualityReport {
+	report := &QualityReport{Samples: samples, Alpha: alpha}
+	add := func(name string, statistic, pValue float64) {
+		report.Results = append(report.Results, QualityResult{name, statistic, pValue, pValue >= alpha})
+	}
+
+	uniforms := make([]float64, samples)
+	for i := range uniforms {
+		uniforms[i] = g.Random()
+	}
+
+	statistic, pValue := chiSquareUniformity(uniforms, 100)
+	add("chi-square (100 bins)", statistic, pValue)
+	statistic, pValue = kolmogorovSmirnov(uniforms)
+	add("kolmogorov-smirnov", statistic, pValue)
+	statistic, pValue = serialCorrelation(uniforms)
+	add("serial correlation (lag 1)", statistic, pValue)
+	statistic, pValue = runsTest(uniforms)
+	add("runs above/below median", statistic, pValue)
+	statistic, pValue = randIntUniformity(g, samples, 7)
+	add("RandInt(0, 7) chi-square", statistic, pValue)
+	for _, lambda := range []float64{0.3, 25} {
+		mean, dispersion := poissonMoments(g, samples, lambda)
+		add(fmt.Sprintf("Poi(%g) mean", lambda), mean, normalPValue(mean))
+		add(fmt.Sprintf("Poi(%g) variance", lambda), dispersion, normalPValue(dispersion))
+	}
+	return report
+}
+
+func (r *QualityReport) Passed() bool {
+	for _, result := range r.Results {
+		if !result.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *QualityReport) Print() {
+	fmt.Printf("%-28s %12s %10s  %s\n", "test", "statistic", "p-value", "result")
+	for _, result := range r.Results {
+		status := "PASS"
+		if !result.Passed {
+			status = "FAIL"
+		}
+		fmt.Printf("%-28s %12.4f %10.4f  %s\n", result.Name, result.Statistic, result.PValue, status)
+	}
+}
+
+func chiSquareUniformity(uniforms []float64, bins int) (float64, float64) {
+	counts := make([]int, bins)
+	for _, u := range uniforms {
+		counts[min(int(u*float64(bins)), bins-1)]++
+	}
+	return chiSquare(counts, float64(len(uniforms))/float64(bins))
+}
+
+func randIntUniformity(g Generator, samples int, n int) (float64, float64) {
+	counts := make([]int, n)
+	for i := 0; i < samples; i++ {
+		counts[g.RandInt(0, n)]++
+	}
+	return chiSquare(counts, float64(samples)/float64(n))
+}
+
+func chiSquare(counts []int, expected float64) (float64, float64) {
+	statistic := 0.0
+	for _, c := range counts {
+		statistic += (float64(c) - expected) * (float64(c) - expected) / expected
+	}
+	return statistic, gammaQ(float64(len(counts)-1)/2, statistic/2)
+}
+
+func kolmogorovSmirnov(uniforms []float64) (float64, float64) {
+	sorted := append([]float64(nil), uniforms...)
+	sort.Float64s(sorted)
+	n := float64(len(sorted))
+	d := 0.0
+	for i, u := range sorted {
+		d = max(d, float64(i+1)/n-u, u-float64(i)/n)
+	}
+	sqrtN := math.Sqrt(n)
+	return d, kolmogorovQ((sqrtN + 0.12 + 0.11/sqrtN) * d)
+}
+
+// kolmogorovQ is the survival function of the Kolmogorov distribution.
+func kolmogorovQ(x float64) float64 {
+	if x < 0.2 {
+		return 1
+	}
+	sum := 0.0
+	sign := 1.0
+	for k := 1; k <= 100; k++ {
+		term := sign * math.Exp(-2*float64(k*k)*x*x)
+		sum += term
+		if math.Abs(term) < 1e-12 {
+			break
+		}
+		sign = -sign
+	}
+	return min(1, max(0, 2*sum))
+}
+
+// serialCorrelation returns the lag-1 autocorrelation as a standard normal
+// score.
+func serialCorrelation(uniforms []float64) (float64, float64) {
+	n := len(uniforms)
+	mean := 0.0
+	for _, u := range uniforms {
+		mean += u
+	}
+	mean /= float64(n)
+	num, den := 0.0, 0.0
+	for i, u := range uniforms {
+		den += (u - mean) * (u - mean)
+		if i > 0 {
+			num += (u - mean) * (uniforms[i-1] - mean)
+		}
+	}
+	z := num / den * math.Sqrt(float64(n))
+	return z, normalPValue(z)
+}
+
+// runsTest counts the runs of values above and below 0.5 and returns their
+// deviation from the expected amount as a standard normal score.
+func runsTest(uniforms []float64) (float64, float64) {
+	above, below, runs := 0.0, 0.0, 0.0
+	for i, u := range uniforms {
+		if u >= 0.5 {
+			above++
+		} else {
+			below++
+		}
+		if i == 0 || (u >= 0.5) != (uniforms[i-1] >= 0.5) {
+			runs++
+		}
+	}
+	n := above + below
+	expected := 2*above*below/n + 1
+	variance := 2 * above * below * (2*above*below - n) / (n * n * (n - 1))
+	z := (runs - expected) / math.Sqrt(variance)
+	return z, normalPValue(z)
+}
+
+// poissonMoments returns the sample mean and the index of dispersion of
+// Poisson draws, both as standard normal scores. The index of dispersion,
+// the sum of squared deviations over the sample mean, is close to a
+// chi-square with n-1 degrees of freedom.
+func poissonMoments(g Generator, samples int, lambda float64) (float64, float64) {
+	n := float64(samples)
+	sum, sumSq := 0.0, 0.0
+	for i := 0; i < samples; i++ {
+		x := float64(g.Poi(lambda))
+		sum += x
+		sumSq += x * x
+	}
+	mean := sum / n
+	squares := sumSq - n*mean*mean
+	meanZ := (mean - lambda) / math.Sqrt(lambda/n)
+	dispersionZ := (squares/mean - (n - 1)) / math.Sqrt(2*(n-1))
+	return meanZ, dispersionZ
+}
+
+func normalPValue(z float64) float64 {
+	return math.Erfc(math.Abs(z) / math.Sqrt2)
+}
+
+// gammaQ is the regularized upper incomplete gamma function Q(a, x).
+func gammaQ(a, x float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+	lg, _ := math.Lgamma(a)
+	if x < a+1 {
+		sum := 1 / a
+		term := sum
+		for n := 1; n < 1000; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*1e-15 {
+				break
+			}
+		}
+		return 1 - sum*math.Exp(-x+a*math.Log(x)-lg)
+	}
+	b := x + 1 - a
+	c := 1 / 1e-300
+	d := 1 / b
+	h := d
+	for i := 1; i < 1000; i++ {
+		an := -float64(i) * (float64(i) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < 1e-300 {
+			d = 1e-300
+		}
+		c = b + an/c
+		if math.Abs(c) < 1e-300 {
+			c = 1e-300
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-15 {
+			break
+		}
+	}
+	return math.Exp(-x+a*math.Log(x)-lg) * h
+}
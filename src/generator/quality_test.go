@@ -0,0 +1,88 @@
+package generator
+
+import (
+	"math"
+	"testing"
+)
+
+const (
+	qualitySamples = 200000
+	qualityAlpha   = 0.001
+)
+
+// qualitySeeds are replication seeds, checked so that a test cannot pass by
+// one lucky seed.
+var qualitySeeds = []uint64{9000000, 9000001, 9000100, 9004217, 9123457}
+
+func TestCheckQualityPassesEveryGenerator(t *testing.T) {
+	for _, name := range Names() {
+		for _, antithetic := range []bool{false, true} {
+			factory, err := Lookup(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			label := name
+			if antithetic {
+				factory = AntitheticFactory(factory)
+				label += "/antithetic"
+			}
+			t.Run(label, func(t *testing.T) {
+				for _, seed := range qualitySeeds {
+					report := CheckQuality(factory(seed), qualitySamples, qualityAlpha)
+					if len(report.Results) != 9 {
+						t.Fatalf("seed %d: got %d results, want 9", seed, len(report.Results))
+					}
+					for _, result := range report.Results {
+						if math.IsNaN(result.PValue) || result.PValue < 0 || result.PValue > 1 {
+							t.Errorf("seed %d: %s: p-value %g out of [0, 1]", seed, result.Name, result.PValue)
+						}
+						if !result.Passed {
+							t.Errorf("seed %d: %s failed: statistic %g, p-value %g", seed, result.Name, result.Statistic, result.PValue)
+						}
+					}
+					if !report.Passed() {
+						t.Errorf("seed %d: report did not pass", seed)
+					}
+				}
+			})
+		}
+	}
+}
+
+// sawtooth cycles evenly through [0, 1), which is uniform but far from
+// random.
+type sawtooth struct {
+	sampler
+	i, n int
+}
+
+func newSawtooth(n int) *sawtooth {
+	s := &sawtooth{n: n}
+	s.sampler = sampler{s}
+	return s
+}
+
+func (s *sawtooth) Random() float64 {
+	u := float64(s.i) / float64(s.n)
+	s.i = (s.i + 1) % s.n
+	return u
+}
+
+func (s *sawtooth) Save() []byte               { return nil }
+func (s *sawtooth) Restore(state []byte) error { return nil }
+
+func TestCheckQualityFailsPredictableGenerator(t *testing.T) {
+	report := CheckQuality(newSawtooth(1000), qualitySamples, qualityAlpha)
+	if report.Passed() {
+		t.Fatal("a sawtooth passed the quality checks")
+	}
+	failed := make(map[string]bool)
+	for _, result := range report.Results {
+		failed[result.Name] = !result.Passed
+	}
+	for _, name := range []string{"serial correlation (lag 1)", "runs above/below median"} {
+		if !failed[name] {
+			t.Errorf("%s passed a sawtooth", name)
+		}
+	}
+}
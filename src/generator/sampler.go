@@ -0,0 +1,190 @@
+package generator
+
+import "math"
+
+type source interface {
+	Random() float64
+}
+
+// sampler implements the derived distributions on top of a uniform source,
+// so every generator draws them in exactly the same way.
+type sampler struct {
+	src source
+}
+
+// / Returns a random integer in the range [a, b)
+func (s sampler) RandInt(a int, b int) int {
+	p := (float64(b-a))*s.src.Random() + float64(a)
+	return int(p)
+}
+
+// Poi draws from a Poisson distribution. Small rates use Knuth's
+// multiplicative method, which keeps the draws of the original model;
+// from poissonPTRSThreshold on, Hörmann's transformed rejection (PTRS) is
+// used, which needs a constant number of draws and does not underflow.
+func (s sampler) Poi(lambda float64) int {
+	if lambda <= 0 {
+		return 0
+	}
+	if lambda >= poissonPTRSThreshold {
+		return s.poissonPTRS(lambda)
+	}
+	L := math.Exp(-lambda)
+	k := 0
+	p := 1.0
+	for p > L {
+		k++
+		v := s.src.Random()
+		p *= v
+	}
+	return k - 1
+}
+
+const poissonPTRSThreshold = 10
+
+func (s sampler) poissonPTRS(lambda float64) int {
+	slam := math.Sqrt(lambda)
+	loglam := math.Log(lambda)
+	b := 0.931 + 2.53*slam
+	a := -0.059 + 0.02483*b
+	invalpha := 1.1239 + 1.1328/(b-3.4)
+	vr := 0.9277 - 3.6224/(b-2)
+
+	for {
+		u := s.src.Random() - 0.5
+		v := s.src.Random()
+		us := 0.5 - math.Abs(u)
+		k := math.Floor((2*a/us+b)*u + lambda + 0.43)
+		if us >= 0.07 && v <= vr {
+			return int(k)
+		}
+		if k < 0 || (us < 0.013 && v > us) {
+			continue
+		}
+		lg, _ := math.Lgamma(k + 1)
+		if math.Log(v)+math.Log(invalpha)-math.Log(a/(us*us)+b) <= -lambda+k*loglam-lg {
+			return int(k)
+		}
+	}
+}
+
+// Binomial draws the number of successes in n trials of probability p, by
+// inversion when n*p is small and by Hörmann's BTRS rejection otherwise.
+func (s sampler) Binomial(n int, p float64) int {
+	if n <= 0 || p <= 0 {
+		return 0
+	}
+	if p >= 1 {
+		return n
+	}
+	if p > 0.5 {
+		return n - s.Binomial(n, 1-p)
+	}
+	if float64(n)*p < 10 {
+		return s.binomialInversion(n, p)
+	}
+	return s.binomialBTRS(n, p)
+}
+
+func (s sampler) binomialInversion(n int, p float64) int {
+	q := 1 - p
+	r := p / q
+	prob := math.Pow(q, float64(n))
+	u := s.src.Random()
+	k := 0
+	for u > prob && k < n {
+		u -= prob
+		k++
+		prob *= r * float64(n-k+1) / float64(k)
+	}
+	return k
+}
+
+func (s sampler) binomialBTRS(n int, p float64) int {
+	fn := float64(n)
+	q := 1 - p
+	spq := math.Sqrt(fn * p * q)
+	b := 1.15 + 2.53*spq
+	a := -0.0873 + 0.0248*b + 0.01*p
+	c := fn*p + 0.5
+	vr := 0.92 - 4.2/b
+	alpha := (2.83 + 5.1/b) * spq
+	lpq := math.Log(p / q)
+	m := math.Floor((fn + 1) * p)
+	lgm, _ := math.Lgamma(m + 1)
+	lgnm, _ := math.Lgamma(fn - m + 1)
+	h := lgm + lgnm
+
+	for {
+		u := s.src.Random() - 0.5
+		v := s.src.Random()
+		us := 0.5 - math.Abs(u)
+		k := math.Floor((2*a/us+b)*u + c)
+		if k < 0 || k > fn {
+			continue
+		}
+		if us >= 0.07 && v <= vr {
+			return int(k)
+		}
+		v = math.Log(v * alpha / (a/(us*us) + b))
+		lgk, _ := math.Lgamma(k + 1)
+		lgnk, _ := math.Lgamma(fn - k + 1)
+		if v <= h-lgk-lgnk+(k-m)*lpq {
+			return int(k)
+		}
+	}
+}
+
+// NegBinomial draws the number of failures before the r-th success with
+// success probability p, as a Poisson whose rate follows a gamma
+// distribution. Its variance exceeds its mean, which suits platoon arrivals.
+// It returns 0 unless r > 0 and 0 < p < 1, as there is no failure with
+// p = 1 and no valid distribution otherwise.
+func (s sampler) NegBinomial(r float64, p float64) int {
+	if r <= 0 || p <= 0 || p >= 1 {
+		return 0
+	}
+	return s.Poi(s.gamma(r) * (1 - p) / p)
+}
+
+// gamma draws from a Gamma(shape, 1) distribution (Marsaglia and Tsang).
+func (s sampler) gamma(shape float64) float64 {
+	if shape < 1 {
+		return s.gamma(shape+1) * math.Pow(s.src.Random(), 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := s.Normal()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := s.src.Random()
+		if u < 1-0.0331*x*x*x*x || math.Log(u) < 0.5*x*x+d*(1-v+math.Log(v)) {
+			return d * v
+		}
+	}
+}
+
+// Normal draws from a standard normal distribution (Marsaglia's polar method).
+func (s sampler) Normal() float64 {
+	for {
+		u := 2*s.src.Random() - 1
+		v := 2*s.src.Random() - 1
+		r := u*u + v*v
+		if r > 0 && r < 1 {
+			return u * math.Sqrt(-2*math.Log(r)/r)
+		}
+	}
+}
+
+func (s sampler) Choice(a []any) int {
+	i := s.RandInt(0, len(a))
+	return i
+}
+
+func uint64ToFloat(x uint64) float64 {
+	return float64(x>>11) / (1 << 53)
+}
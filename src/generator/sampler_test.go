@@ -0,0 +1,223 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+const (
+	samplerSamples = 100000
+	// samplerAlpha is smaller than qualityAlpha as every case is checked
+	// three times over every seed.
+	samplerAlpha = 1e-5
+)
+
+// checkDiscrete draws samplerSamples values from draw for every quality
+// seed and checks their mean and variance against the distribution's, and
+// their frequencies against its probability mass function.
+func checkDiscrete(t *testing.T, draw func(g Generator) int, mean, variance float64, pmf func(k int) float64) {
+	t.Helper()
+	for _, seed := range qualitySeeds {
+		g, err := New(DefaultName, seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		draws := make([]int, samplerSamples)
+		for i := range draws {
+			draws[i] = draw(g)
+		}
+		meanZ, varianceZ := momentScores(draws, mean, variance)
+		if p := normalPValue(meanZ); p < samplerAlpha {
+			t.Errorf("seed %d: mean off by %.2f standard errors (p-value %g)", seed, meanZ, p)
+		}
+		if p := normalPValue(varianceZ); p < samplerAlpha {
+			t.Errorf("seed %d: variance off by %.2f standard errors (p-value %g)", seed, varianceZ, p)
+		}
+		if statistic, p := chiSquareFit(draws, pmf); p < samplerAlpha {
+			t.Errorf("seed %d: frequencies do not fit the distribution: chi-square %g, p-value %g", seed, statistic, p)
+		}
+	}
+}
+
+// momentScores returns the distance of the sample mean and variance to the
+// given ones, as standard normal scores. The standard error of the variance
+// is estimated from the sample's fourth central moment.
+func momentScores(draws []int, mean, variance float64) (float64, float64) {
+	n := float64(len(draws))
+	sum := 0.0
+	for _, x := range draws {
+		sum += float64(x)
+	}
+	m := sum / n
+	m2, m4 := 0.0, 0.0
+	for _, x := range draws {
+		d := float64(x) - m
+		m2 += d * d
+		m4 += d * d * d * d
+	}
+	m2 /= n
+	m4 /= n
+	meanZ := (m - mean) / math.Sqrt(variance/n)
+	varianceZ := (m2*n/(n-1) - variance) / math.Sqrt((m4-m2*m2)/n)
+	return meanZ, varianceZ
+}
+
+// chiSquareFit compares the frequencies of the draws with the probability
+// mass function, pooling neighbouring values until every cell expects at
+// least five draws. The last cell holds the whole upper tail.
+func chiSquareFit(draws []int, pmf func(k int) float64) (float64, float64) {
+	maxK := 0
+	counts := make(map[int]int)
+	for _, x := range draws {
+		counts[x]++
+		maxK = max(maxK, x)
+	}
+	n := float64(len(draws))
+	type cell struct{ observed, expected float64 }
+	var cells []cell
+	open := cell{}
+	total := 0.0
+	for k := 0; k <= maxK; k++ {
+		e := n * pmf(k)
+		open.observed += float64(counts[k])
+		open.expected += e
+		total += e
+		if open.expected >= 5 {
+			cells = append(cells, open)
+			open = cell{}
+		}
+	}
+	open.expected += n - total
+	if open.expected >= 5 || len(cells) == 0 {
+		cells = append(cells, open)
+	} else {
+		last := &cells[len(cells)-1]
+		last.observed += open.observed
+		last.expected += open.expected
+	}
+	statistic := 0.0
+	for _, c := range cells {
+		statistic += (c.observed - c.expected) * (c.observed - c.expected) / c.expected
+	}
+	return statistic, gammaQ(float64(len(cells)-1)/2, statistic/2)
+}
+
+func poissonPMF(lambda float64) func(k int) float64 {
+	return func(k int) float64 {
+		lg, _ := math.Lgamma(float64(k) + 1)
+		return math.Exp(-lambda + float64(k)*math.Log(lambda) - lg)
+	}
+}
+
+func binomialPMF(n int, p float64) func(k int) float64 {
+	return func(k int) float64 {
+		if k > n {
+			return 0
+		}
+		ln, _ := math.Lgamma(float64(n) + 1)
+		lk, _ := math.Lgamma(float64(k) + 1)
+		lnk, _ := math.Lgamma(float64(n-k) + 1)
+		return math.Exp(ln - lk - lnk + float64(k)*math.Log(p) + float64(n-k)*math.Log1p(-p))
+	}
+}
+
+func negBinomialPMF(r, p float64) func(k int) float64 {
+	return func(k int) float64 {
+		lkr, _ := math.Lgamma(float64(k) + r)
+		lr, _ := math.Lgamma(r)
+		lk, _ := math.Lgamma(float64(k) + 1)
+		return math.Exp(lkr - lr - lk + r*math.Log(p) + float64(k)*math.Log1p(-p))
+	}
+}
+
+// The rates straddle poissonPTRSThreshold, where Knuth's method gives way
+// to PTRS.
+func TestPoissonFitsDistribution(t *testing.T) {
+	for _, lambda := range []float64{0.5, 3, 9.5, poissonPTRSThreshold - 1e-9, poissonPTRSThreshold, 10.5, 25, 100, 1000} {
+		t.Run(fmt.Sprint(lambda), func(t *testing.T) {
+			checkDiscrete(t, func(g Generator) int { return g.Poi(lambda) }, lambda, lambda, poissonPMF(lambda))
+		})
+	}
+}
+
+// The cases straddle n·p = 10, where inversion gives way to BTRS, and
+// p = 0.5, above which the failures are drawn instead.
+func TestBinomialFitsDistribution(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		p    float64
+	}{
+		{"inversion", 20, 0.3},
+		{"inversion below n·p = 10", 33, 0.3},
+		{"BTRS above n·p = 10", 34, 0.3},
+		{"BTRS at n·p = 10", 20, 0.5},
+		{"BTRS with many trials", 1000, 0.02},
+		{"reflected inversion", 20, 0.7},
+		{"reflected BTRS", 100, 0.51},
+		{"reflected BTRS near 1", 2000, 0.99},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mean := float64(tt.n) * tt.p
+			checkDiscrete(t, func(g Generator) int { return g.Binomial(tt.n, tt.p) }, mean, mean*(1-tt.p), binomialPMF(tt.n, tt.p))
+		})
+	}
+}
+
+// The cases cover gamma shapes below and above 1, and mixed rates on both
+// sides of poissonPTRSThreshold.
+func TestNegBinomialFitsDistribution(t *testing.T) {
+	tests := []struct {
+		name string
+		r, p float64
+	}{
+		{"shape below 1", 0.5, 0.3},
+		{"geometric", 1, 0.5},
+		{"few failures", 3, 0.9},
+		{"mean across the PTRS threshold", 5, 0.35},
+		{"many failures", 10, 0.1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mean := tt.r * (1 - tt.p) / tt.p
+			checkDiscrete(t, func(g Generator) int { return g.NegBinomial(tt.r, tt.p) }, mean, mean/tt.p, negBinomialPMF(tt.r, tt.p))
+		})
+	}
+}
+
+func TestSamplerEdges(t *testing.T) {
+	g, err := New(DefaultName, qualitySeeds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		draw func() int
+		want int
+	}{
+		{"Poisson with rate 0", func() int { return g.Poi(0) }, 0},
+		{"Poisson with a negative rate", func() int { return g.Poi(-3) }, 0},
+		{"binomial without trials", func() int { return g.Binomial(0, 0.5) }, 0},
+		{"binomial with negative trials", func() int { return g.Binomial(-4, 0.5) }, 0},
+		{"binomial with p = 0", func() int { return g.Binomial(10, 0) }, 0},
+		{"binomial with p < 0", func() int { return g.Binomial(10, -0.2) }, 0},
+		{"binomial with p = 1", func() int { return g.Binomial(10, 1) }, 10},
+		{"binomial with p > 1", func() int { return g.Binomial(10, 1.5) }, 10},
+		{"negative binomial with r = 0", func() int { return g.NegBinomial(0, 0.5) }, 0},
+		{"negative binomial with r < 0", func() int { return g.NegBinomial(-2, 0.5) }, 0},
+		{"negative binomial with p = 0", func() int { return g.NegBinomial(3, 0) }, 0},
+		{"negative binomial with p < 0", func() int { return g.NegBinomial(3, -0.5) }, 0},
+		{"negative binomial with p = 1", func() int { return g.NegBinomial(3, 1) }, 0},
+		{"negative binomial with p > 1", func() int { return g.NegBinomial(3, 1.5) }, 0},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if got := tt.draw(); got != tt.want {
+				t.Errorf("%s: drew %d, want %d", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
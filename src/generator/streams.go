@@ -0,0 +1,85 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+)
+
+// Streams derives independent generators from a single master seed. Each
+// stream is identified by a name ("arrivals/west", "update-order", ...) and
+// its seed only depends on the master seed and that name, so drawing more
+// or fewer numbers from one stream never shifts the others.
+type Streams struct {
+	factory Factory
+	seed    uint64
+	streams map[string]Generator
+}
+
+func NewStreams(factory Factory, seed uint64) *Streams {
+	return &Streams{factory, seed, make(map[string]Generator)}
+}
+
+func (s *Streams) Seed() uint64 {
+	return s.seed
+}
+
+func (s *Streams) SeedFor(name string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	_, seed := splitMix64(s.seed ^ h.Sum64())
+	return seed
+}
+
+func (s *Streams) Get(name string) Generator {
+	if g, ok := s.streams[name]; ok {
+		return g
+	}
+	g := s.factory(s.SeedFor(name))
+	s.streams[name] = g
+	return g
+}
+
+type streamsState struct {
+	Seed    uint64            `json:"seed"`
+	Streams map[string][]byte `json:"streams"`
+}
+
+// Save serializes the state of every stream created so far.
+func (s *Streams) Save() []byte {
+	state := streamsState{s.seed, make(map[string][]byte, len(s.streams))}
+	for name, g := range s.streams {
+		state.Streams[name] = g.Save()
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// Clone returns streams of the same seed in the same state, which draw the
+// same numbers from then on independently of these.
+func (s *Streams) Clone() *Streams {
+	clone := NewStreams(s.factory, s.seed)
+	if err := clone.Restore(s.Save()); err != nil {
+		panic(err)
+	}
+	return clone
+}
+
+func (s *Streams) Restore(data []byte) error {
+	var state streamsState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	if state.Seed != s.seed {
+		return fmt.Errorf("state was saved from seed %d, not %d", state.Seed, s.seed)
+	}
+	for name, streamState := range state.Streams {
+		if err := s.Get(name).Restore(streamState); err != nil {
+			return fmt.Errorf("stream %q: %w", name, err)
+		}
+	}
+	return nil
+}
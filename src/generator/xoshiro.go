@@ -0,0 +1,68 @@
+package generator
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// Xoshiro256 is the xoshiro256** generator by Blackman and Vigna, seeded
+// through splitmix64 so that close seeds give unrelated states.
+type Xoshiro256 struct {
+	sampler
+	s [4]uint64
+}
+
+func NewXoshiro256(seed uint64) *Xoshiro256 {
+	x := &Xoshiro256{}
+	for i := range x.s {
+		seed, x.s[i] = splitMix64(seed)
+	}
+	x.sampler = sampler{x}
+	return x
+}
+
+func splitMix64(state uint64) (uint64, uint64) {
+	state += 0x9e3779b97f4a7c15
+	z := state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return state, z ^ (z >> 31)
+}
+
+func (x *Xoshiro256) Uint64() uint64 {
+	result := bits.RotateLeft64(x.s[1]*5, 7) * 9
+	t := x.s[1] << 17
+
+	x.s[2] ^= x.s[0]
+	x.s[3] ^= x.s[1]
+	x.s[1] ^= x.s[2]
+	x.s[0] ^= x.s[3]
+
+	x.s[2] ^= t
+	x.s[3] = bits.RotateLeft64(x.s[3], 45)
+
+	return result
+}
+
+func (x *Xoshiro256) Random() float64 {
+	return uint64ToFloat(x.Uint64())
+}
+
+func (x *Xoshiro256) Save() []byte {
+	state := make([]byte, 8*len(x.s))
+	for i, s := range x.s {
+		binary.LittleEndian.PutUint64(state[8*i:], s)
+	}
+	return state
+}
+
+func (x *Xoshiro256) Restore(state []byte) error {
+	if len(state) != 8*len(x.s) {
+		return fmt.Errorf("invalid xoshiro256** state length %d", len(state))
+	}
+	for i := range x.s {
+		x.s[i] = binary.LittleEndian.Uint64(state[8*i:])
+	}
+	return nil
+}
@@ -3,36 +3,37 @@ package grid
 import (
 	"errors"
 	"fmt"
-	"go_automata/src/generator"
 	"go_automata/src/utils"
 )
 
-type Grid struct {
-	rows      int
-	cols      int
-	grid      [][]interface{}
-	generator generator.Generator
+// Grid holds a value of type T in every cell, its zero value meaning the
+// cell is empty. T is usually an interface or pointer type.
+type Grid[T comparable] struct {
+	rows int
+	cols int
+	grid [][]T
 }
 
-func NewGrid(rows, cols int, generator generator.Generator) *Grid {
-	grid := make([][]interface{}, rows)
+func NewGrid[T comparable](rows, cols int) *Grid[T] {
+	grid := make([][]T, rows)
 	for i := range grid {
-		grid[i] = make([]interface{}, cols)
+		grid[i] = make([]T, cols)
 	}
-	return &Grid{rows, cols, grid, generator}
+	return &Grid[T]{rows, cols, grid}
 }
 
-func (g *Grid) IsFill(row, col int) bool {
+func (g *Grid[T]) IsFill(row, col int) bool {
 	if row < 0 || row >= g.rows {
 		return false
 	}
 	if col < 0 || col >= g.cols {
 		return false
 	}
-	return g.grid[row][col] != nil
+	var empty T
+	return g.grid[row][col] != empty
 }
 
-func (g *Grid) Fill(row, col int, v interface{}) error {
+func (g *Grid[T]) Fill(row, col int, v T) error {
 	if g.IsFill(row, col) {
 		return errors.New("cell already filled")
 	}
@@ -40,23 +41,31 @@ func (g *Grid) Fill(row, col int, v interface{}) error {
 	return nil
 }
 
-func (g *Grid) Clear(row, col int) {
+func (g *Grid[T]) Clear(row, col int) {
 	if !g.IsFill(row, col) {
 		panic("Attempted to clear an empty cell")
 	}
-	g.grid[row][col] = nil
+	var empty T
+	g.grid[row][col] = empty
 }
 
-func (g *Grid) GetValue(row, col int) interface{} {
+// Reset empties every cell.
+func (g *Grid[T]) Reset() {
+	for _, row := range g.grid {
+		clear(row)
+	}
+}
+
+func (g *Grid[T]) GetValue(row, col int) T {
 	if !g.IsFill(row, col) {
 		panic("Element not found")
 	}
 	return g.grid[row][col]
 }
 
-func (g *Grid) CalcDistToNext(row, col int, f func(interface{}) bool, maxChecks int) int {
+func (g *Grid[T]) CalcDistToNext(row, col int, f func(T) bool, maxChecks int) int {
 	if f == nil {
-		f = func(interface{}) bool { return true }
+		f = func(T) bool { return true }
 	}
 	if maxChecks == 0 {
 		maxChecks = g.cols - col
@@ -69,9 +78,9 @@ func (g *Grid) CalcDistToNext(row, col int, f func(interface{}) bool, maxChecks
 	return -1
 }
 
-func (g *Grid) CalcDistToPrev(row, col int, f func(interface{}) bool, maxChecks int) int {
+func (g *Grid[T]) CalcDistToPrev(row, col int, f func(T) bool, maxChecks int) int {
 	if f == nil {
-		f = func(interface{}) bool { return true }
+		f = func(T) bool { return true }
 	}
 	if maxChecks == 0 {
 		maxChecks = col
@@ -84,9 +93,9 @@ func (g *Grid) CalcDistToPrev(row, col int, f func(interface{}) bool, maxChecks
 	return -1
 }
 
-func (g *Grid) CalcDistToVerticallyNext(row, col int, f func(interface{}) bool, maxChecks int) int {
+func (g *Grid[T]) CalcDistToVerticallyNext(row, col int, f func(T) bool, maxChecks int) int {
 	if f == nil {
-		f = func(interface{}) bool { return true }
+		f = func(T) bool { return true }
 	}
 	if maxChecks == 0 {
 		maxChecks = g.rows - row
@@ -99,9 +108,9 @@ func (g *Grid) CalcDistToVerticallyNext(row, col int, f func(interface{}) bool,
 	return -1
 }
 
-func (g *Grid) CalcDistToVerticallyPrev(row, col int, f func(interface{}) bool, maxChecks int) int {
+func (g *Grid[T]) CalcDistToVerticallyPrev(row, col int, f func(T) bool, maxChecks int) int {
 	if f == nil {
-		f = func(interface{}) bool { return true }
+		f = func(T) bool { return true }
 	}
 	if maxChecks == 0 {
 		maxChecks = row
@@ -114,81 +123,63 @@ func (g *Grid) CalcDistToVerticallyPrev(row, col int, f func(interface{}) bool,
 	return -1
 }
 
-func (g *Grid) GetPrev(row, col int, f func(interface{}) bool, maxChecks int) interface{} {
+func (g *Grid[T]) GetPrev(row, col int, f func(T) bool, maxChecks int) T {
 	if maxChecks == 0 {
 		maxChecks = col
 	}
 	dist := g.CalcDistToPrev(row, col, f, maxChecks)
 	if dist == -1 {
-		return nil
+		var empty T
+		return empty
 	}
 	return g.GetValue(row, col-dist-1)
 }
 
-func (g *Grid) GetVerticallyPrev(row, col int, f func(interface{}) bool, maxChecks int) interface{} {
+func (g *Grid[T]) GetVerticallyPrev(row, col int, f func(T) bool, maxChecks int) T {
 	if maxChecks == 0 {
 		maxChecks = row
 	}
 	dist := g.CalcDistToVerticallyPrev(row, col, f, maxChecks)
 	if dist == -1 {
-		return nil
+		var empty T
+		return empty
 	}
 	return g.GetValue(row-dist-1, col)
 }
 
-func (g *Grid) GetNext(row, col int, f func(interface{}) bool, maxChecks int) interface{} {
+func (g *Grid[T]) GetNext(row, col int, f func(T) bool, maxChecks int) T {
 	if maxChecks == 0 {
 		maxChecks = g.cols - col
 	}
 	dist := g.CalcDistToNext(row, col, f, maxChecks)
 	if dist == -1 {
-		return nil
+		var empty T
+		return empty
 	}
 	return g.GetValue(row, col+dist+1)
 }
 
-func (g *Grid) GetVerticallyNext(row, col int, f func(interface{}) bool, maxChecks int) interface{} {
+func (g *Grid[T]) GetVerticallyNext(row, col int, f func(T) bool, maxChecks int) T {
 	if maxChecks == 0 {
 		maxChecks = g.rows
 	}
 	dist := g.CalcDistToVerticallyNext(row, col, f, maxChecks)
 	if dist == -1 {
-		return nil
+		var empty T
+		return empty
 	}
 	return g.GetValue(row+dist+1, col)
 }
 
-func (g *Grid) getCellsWithValue() []interface{} {
-	values := []interface{}{}
-	for i := 0; i < g.rows; i++ {
-		for j := 0; j < g.cols; j++ {
-			if g.IsFill(i, j) {
-				values = append(values, g.GetValue(i, j))
-			}
-		}
-	}
-	return values
-}
-
-func (g *Grid) Apply(f func(interface{})) {
-	values := g.getCellsWithValue()
-	for len(values) > 0 {
-		pos := g.generator.RandInt(0, len(values))
-		value := values[pos]
-		values = append(values[:pos], values[pos+1:]...)
-		f(value)
-	}
-}
-
-func (g *Grid) Rows() int {
+func (g *Grid[T]) Rows() int {
 	return g.rows
 }
 
-func (g *Grid) Cols() int {
+func (g *Grid[T]) Cols() int {
 	return g.cols
 }
 
-func (g *Grid) Plot(f func(*utils.Point, interface{}) string, bounds *utils.Rectangle) {
+func (g *Grid[T]) Plot(f func(*utils.Point, T) string, bounds *utils.Rectangle) {
 	if bounds == nil {
 		bounds = utils.NewRectangle(g.rows, g.cols)
 	}
@@ -202,13 +193,11 @@ func (g *Grid) Plot(f func(*utils.Point, interface{}) string, bounds *utils.Rect
 			if !bounds.IsInside(point) {
 				continue
 			}
-			var s string
+			var value T
 			if g.IsFill(row, col) {
-				s = f(point, g.GetValue(row, col))
-			} else {
-				s = f(point, nil)
+				value = g.GetValue(row, col)
 			}
-			print(s)
+			print(f(point, value))
 		}
 		println()
 	}
@@ -2,39 +2,51 @@ package grid
 
 import "go_automata/src/utils"
 
-type RelativeGrid struct {
+// RelativeGrid is a view of a Grid from a cell, facing a direction, within
+// bounds.
+type RelativeGrid[T comparable] struct {
 	center utils.Point
 	bounds *utils.Rectangle
 	facing utils.Direction
-	grid   *Grid
+	grid   *Grid[T]
 }
 
-func NewRelativeGrid(center utils.Point, bounds *utils.Rectangle, facing utils.Direction, grid *Grid) *RelativeGrid {
-	return &RelativeGrid{center, bounds, facing, grid}
+func NewRelativeGrid[T comparable](center utils.Point, bounds *utils.Rectangle, facing utils.Direction, grid *Grid[T]) *RelativeGrid[T] {
+	return &RelativeGrid[T]{center, bounds, facing, grid}
 }
 
-func (rg *RelativeGrid) NewDisplaced(displacement *utils.RelativePosition) *RelativeGrid {
+func (rg *RelativeGrid[T]) NewDisplaced(displacement *utils.RelativePosition) *RelativeGrid[T] {
 	newCenter := displacement.Apply(rg.facing, rg.center)
 	return NewRelativeGrid(newCenter, rg.bounds, rg.facing, rg.grid)
 }
 
-func (rg *RelativeGrid) Facing() utils.Direction {
+// WithCenter returns the same view from another cell.
+func (rg *RelativeGrid[T]) WithCenter(center utils.Point) *RelativeGrid[T] {
+	return NewRelativeGrid(center, rg.bounds, rg.facing, rg.grid)
+}
+
+func (rg *RelativeGrid[T]) Facing() utils.Direction {
 	return rg.facing
 }
 
-func (rg *RelativeGrid) Rows() int {
+// Position returns the cell of the grid at displacement from the center.
+func (rg *RelativeGrid[T]) Position(displacement *utils.RelativePosition) utils.Point {
+	return displacement.Apply(rg.facing, rg.center)
+}
+
+func (rg *RelativeGrid[T]) Rows() int {
 	return rg.bounds.Rows()
 }
 
-func (rg *RelativeGrid) Cols() int {
+func (rg *RelativeGrid[T]) Cols() int {
 	return rg.bounds.Cols()
 }
 
-func (rg *RelativeGrid) IsIn(zone *utils.Rectangle) bool {
+func (rg *RelativeGrid[T]) IsIn(zone *utils.Rectangle) bool {
 	return zone.IsInside(&rg.center)
 }
 
-func (rg *RelativeGrid) Fill(displacement *utils.RelativePosition, obj interface{}) {
+func (rg *RelativeGrid[T]) Fill(displacement *utils.RelativePosition, obj T) {
 	if !rg.IsInbounds(displacement) {
 		panic("Attempted to fill an out of bounds cell")
 	}
@@ -43,23 +55,24 @@ func (rg *RelativeGrid) Fill(displacement *utils.RelativePosition, obj interface
 	rg.grid.Fill(point.X, point.Y, obj)
 }
 
-func (rg *RelativeGrid) IsFill(displacement *utils.RelativePosition) bool {
+func (rg *RelativeGrid[T]) IsFill(displacement *utils.RelativePosition) bool {
 	point := displacement.Apply(rg.facing, rg.center)
 	return rg.grid.IsFill(point.X, point.Y)
 }
 
-func (rg *RelativeGrid) Get(displacement *utils.RelativePosition) interface{} {
+func (rg *RelativeGrid[T]) Get(displacement *utils.RelativePosition) T {
+	var empty T
 	if !rg.IsInbounds(displacement) {
-		return nil
+		return empty
 	}
 	point := displacement.Apply(rg.facing, rg.center)
 	if !rg.grid.IsFill(point.X, point.Y) {
-		return nil
+		return empty
 	}
 	return rg.grid.GetValue(point.X, point.Y)
 }
 
-func (rg *RelativeGrid) IsInbounds(displacement *utils.RelativePosition) bool {
+func (rg *RelativeGrid[T]) IsInbounds(displacement *utils.RelativePosition) bool {
 	point := displacement.Apply(rg.facing, rg.center)
 	if !rg.bounds.IsInside(&point) {
 		return false
@@ -68,9 +81,9 @@ func (rg *RelativeGrid) IsInbounds(displacement *utils.RelativePosition) bool {
 	return 0 <= point.X && point.X < rg.grid.Rows() && 0 <= point.Y && point.Y < rg.grid.Cols()
 }
 
-func (rg *RelativeGrid) GetPrev(displacement *utils.RelativePosition, f func(interface{}) bool, maxChecks int) interface{} {
+func (rg *RelativeGrid[T]) GetPrev(displacement *utils.RelativePosition, f func(T) bool, maxChecks int) T {
 	if f == nil {
-		f = func(interface{}) bool { return true }
+		f = func(T) bool { return true }
 	}
 
 	point := displacement.Apply(rg.facing, rg.center)
@@ -83,12 +96,13 @@ func (rg *RelativeGrid) GetPrev(displacement *utils.RelativePosition, f func(int
 	} else if rg.facing == utils.South {
 		return rg.grid.GetVerticallyPrev(point.X, point.Y, f, maxChecks)
 	}
-	return nil
+	var empty T
+	return empty
 }
 
-func (rg *RelativeGrid) GetNext(displacement *utils.RelativePosition, f func(interface{}) bool, maxChecks int) interface{} {
+func (rg *RelativeGrid[T]) GetNext(displacement *utils.RelativePosition, f func(T) bool, maxChecks int) T {
 	if f == nil {
-		f = func(interface{}) bool { return true }
+		f = func(T) bool { return true }
 	}
 
 	point := displacement.Apply(rg.facing, rg.center)
@@ -101,12 +115,13 @@ func (rg *RelativeGrid) GetNext(displacement *utils.RelativePosition, f func(int
 	} else if rg.facing == utils.South {
 		return rg.grid.GetVerticallyNext(point.X, point.Y, f, maxChecks)
 	}
-	return nil
+	var empty T
+	return empty
 }
 
-func (rg *RelativeGrid) CalcDistToNext(displacement *utils.RelativePosition, f func(interface{}) bool, maxChecks int) int {
+func (rg *RelativeGrid[T]) CalcDistToNext(displacement *utils.RelativePosition, f func(T) bool, maxChecks int) int {
 	if f == nil {
-		f = func(interface{}) bool { return true }
+		f = func(T) bool { return true }
 	}
 	point := displacement.Apply(rg.facing, rg.center)
 	if rg.facing == utils.East {
@@ -121,9 +136,9 @@ func (rg *RelativeGrid) CalcDistToNext(displacement *utils.RelativePosition, f f
 	panic("Invalid direction")
 }
 
-func (rg *RelativeGrid) CalcDistToPrev(displacement *utils.RelativePosition, f func(interface{}) bool, maxChecks int) int {
+func (rg *RelativeGrid[T]) CalcDistToPrev(displacement *utils.RelativePosition, f func(T) bool, maxChecks int) int {
 	if f == nil {
-		f = func(interface{}) bool { return true }
+		f = func(T) bool { return true }
 	}
 	point := displacement.Apply(rg.facing, rg.center)
 	if rg.facing == utils.East {
@@ -138,17 +153,17 @@ func (rg *RelativeGrid) CalcDistToPrev(displacement *utils.RelativePosition, f f
 	panic("Invalid direction")
 }
 
-func (rg *RelativeGrid) CalcDistToZone(displacement *utils.RelativePosition, zone utils.Rectangle) int {
+func (rg *RelativeGrid[T]) CalcDistToZone(displacement *utils.RelativePosition, zone utils.Rectangle) (int, error) {
 	point := displacement.Apply(rg.facing, rg.center)
 	return zone.DistanceTo(point)
 }
 
-func (rg *RelativeGrid) Clear(displacement *utils.RelativePosition) {
+func (rg *RelativeGrid[T]) Clear(displacement *utils.RelativePosition) {
 	point := displacement.Apply(rg.facing, rg.center)
 	rg.grid.Clear(point.X, point.Y)
 }
 
-func (rg *RelativeGrid) Move(displacement *utils.RelativePosition) {
+func (rg *RelativeGrid[T]) Move(displacement *utils.RelativePosition) {
 	if displacement.IsStill() {
 		return
 	}
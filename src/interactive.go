@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go_automata/src/generator"
+	"go_automata/src/model"
+	"go_automata/src/utils"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type DisplayFlags struct {
+	delay     time.Duration
+	noDisplay bool
+}
+
+func addDisplayFlags(fs *flag.FlagSet) *DisplayFlags {
+	df := &DisplayFlags{}
+	fs.DurationVar(&df.delay, "delay", 200*time.Millisecond, "pause between displayed epochs")
+	fs.BoolVar(&df.noDisplay, "no-display", false, "do not show the grid, only the final summary")
+	return df
+}
+
+// advance updates the automata until the given epoch, or until ctx is done,
+// showing every epoch unless the display is disabled, and records the state
+// due at the epoch it stops at.
+func (df *DisplayFlags) advance(ctx context.Context, automata *model.Automata, epoch int) {
+	for automata.Epoch < epoch && ctx.Err() == nil {
+		automata.Update()
+		if !df.noDisplay {
+			CallClear()
+			automata.Show()
+			time.Sleep(df.delay)
+		}
+	}
+	automata.RecordState()
+	fmt.Printf("Epoch %d finished with %d conflicts\n", automata.Epoch, automata.Conflicts)
+}
+
+func newStreams(scenarioCfg *ScenarioConfig, seed uint64) (*generator.Streams, error) {
+	factory, err := generator.Lookup(scenarioCfg.Replications.Generator)
+	if err != nil {
+		return nil, err
+	}
+	return generator.NewStreams(factory, seed), nil
+}
+
+func parseEpochs(s string) ([]int, error) {
+	epochs := make([]int, 0)
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		epoch, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid epoch %q: %w", field, err)
+		}
+		epochs = append(epochs, epoch)
+	}
+	return epochs, nil
+}
+
+func stateFileName(dir string, seed uint64, epoch int) string {
+	return filepath.Join(dir, fmt.Sprintf("seed-%d-epoch-%d.state", seed, epoch))
+}
+
+func snapshotFileName(dir string, seed uint64, epoch int) string {
+	return filepath.Join(dir, fmt.Sprintf("seed-%d-epoch-%d.snapshot.json", seed, epoch))
+}
+
+// saveSnapshots writes the snapshots the automata took at the given epochs.
+func saveSnapshots(automata *model.Automata, epochs []int, dir string) error {
+	if len(epochs) > 0 {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	for _, epoch := range epochs {
+		snapshot, ok := automata.RecordedSnapshot(epoch)
+		if !ok {
+			continue
+		}
+		fileName := snapshotFileName(dir, snapshot.Seed, epoch)
+		if err := writeSnapshot(fileName, snapshot); err != nil {
+			return err
+		}
+		fmt.Println("Snapshot at epoch", epoch, "saved in", fileName)
+	}
+	return nil
+}
+
+func writeSnapshot(path string, snapshot *model.Snapshot) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := snapshot.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readSnapshot(path string) (*model.Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	snapshot, err := model.ReadSnapshot(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return snapshot, nil
+}
+
+func runCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	sf := addScenarioFlags(fs)
+	df := addDisplayFlags(fs)
+	seed := fs.Uint64("seed", 9000000, "seed of the run")
+	epochs := fs.Int("epochs", 0, "epochs to simulate, the simulation time if 0")
+	recordEpochs := fs.String("record-epochs", "", "comma separated epochs whose state is saved, for replay -state")
+	snapshotEpochs := fs.String("snapshot-epochs", "", "comma separated epochs whose whole state is saved as a snapshot, for replay -snapshot and diff-snapshots")
+	stateDir := fs.String("state-dir", "results/states", "directory where the recorded states and snapshots are written")
+	fs.Parse(args)
+
+	scenarioCfg, err := sf.Load()
+	if err != nil {
+		return err
+	}
+	record, err := parseEpochs(*recordEpochs)
+	if err != nil {
+		return err
+	}
+	snapshots, err := parseEpochs(*snapshotEpochs)
+	if err != nil {
+		return err
+	}
+	streams, err := newStreams(scenarioCfg, *seed)
+	if err != nil {
+		return err
+	}
+	if *epochs == 0 {
+		*epochs = scenarioCfg.Replications.SimulationTime
+	}
+
+	automata, err := model.NewAutomata(scenarioCfg.Model.Build(), streams)
+	if err != nil {
+		return err
+	}
+	automata.RecordStateAt(record...)
+	automata.RecordSnapshotAt(snapshots...)
+	df.advance(ctx, automata, *epochs)
+
+	if len(record) > 0 {
+		if err := os.MkdirAll(*stateDir, 0755); err != nil {
+			return err
+		}
+	}
+	for _, epoch := range record {
+		state, ok := automata.RecordedState(epoch)
+		if !ok {
+			continue
+		}
+		fileName := stateFileName(*stateDir, *seed, epoch)
+		if err := os.WriteFile(fileName, state, 0644); err != nil {
+			return err
+		}
+		fmt.Println("State at epoch", epoch, "saved in", fileName)
+	}
+	return saveSnapshots(automata, snapshots, *stateDir)
+}
+
+func replayCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	sf := addScenarioFlags(fs)
+	df := addDisplayFlags(fs)
+	seed := fs.Uint64("seed", 9000000, "seed of the replayed run")
+	epoch := fs.Int("epoch", 0, "epoch to rewind to")
+	until := fs.Int("until", 0, "epoch to replay until, the simulation time if 0")
+	statePath := fs.String("state", "", "state recorded by 'run -record-epochs' at -epoch to resume from, instead of replaying from the seed")
+	snapshotPath := fs.String("snapshot", "", "snapshot saved by 'run -snapshot-epochs' to restore, instead of replaying from the seed to -epoch")
+	snapshotEpochs := fs.String("snapshot-epochs", "", "comma separated epochs whose whole state is saved as a snapshot")
+	stateDir := fs.String("state-dir", "results/states", "directory where the snapshots are written")
+	fs.Parse(args)
+
+	scenarioCfg, err := sf.Load()
+	if err != nil {
+		return err
+	}
+	snapshots, err := parseEpochs(*snapshotEpochs)
+	if err != nil {
+		return err
+	}
+	var snapshot *model.Snapshot
+	if *snapshotPath != "" {
+		if *statePath != "" {
+			return fmt.Errorf("-state and -snapshot cannot be used together")
+		}
+		if snapshot, err = readSnapshot(*snapshotPath); err != nil {
+			return err
+		}
+		*seed = snapshot.Seed
+	}
+	streams, err := newStreams(scenarioCfg, *seed)
+	if err != nil {
+		return err
+	}
+	if *until == 0 {
+		*until = scenarioCfg.Replications.SimulationTime
+	}
+
+	config := scenarioCfg.Model.Build()
+	var automata *model.Automata
+	if snapshot != nil {
+		if automata, err = model.NewAutomata(config, streams); err != nil {
+			return err
+		}
+		if err := automata.Restore(snapshot); err != nil {
+			return fmt.Errorf("%s: %w", *snapshotPath, err)
+		}
+	} else if *statePath != "" {
+		state, err := os.ReadFile(*statePath)
+		if err != nil {
+			return err
+		}
+		automata, err = model.NewAutomataAt(config, streams, *epoch, state)
+		if err != nil {
+			return err
+		}
+	} else {
+		if automata, err = model.NewAutomata(config, streams); err != nil {
+			return err
+		}
+		if err := automata.AdvanceToContext(ctx, *epoch); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Rewound to epoch %d with %d conflicts\n", automata.Epoch, automata.Conflicts)
+	automata.RecordSnapshotAt(snapshots...)
+	df.advance(ctx, automata, *until)
+	return saveSnapshots(automata, snapshots, *stateDir)
+}
+
+func diffSnapshotsCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("diff-snapshots", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the differences as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: diff-snapshots [flags] <from.snapshot.json> <to.snapshot.json>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("diff-snapshots takes two snapshot files")
+	}
+
+	from, err := readSnapshot(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	to, err := readSnapshot(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	diff := from.Diff(to)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diff)
+	}
+	fmt.Print(diff)
+	return nil
+}
+
+func forkCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("fork", flag.ExitOnError)
+	sf := addScenarioFlags(fs)
+	seed := fs.Uint64("seed", 9000000, "seed of the run")
+	epoch := fs.Int("epoch", 0, "epoch at which the run is forked")
+	until := fs.Int("until", 0, "epoch both runs are advanced to, the simulation time if 0")
+	snapshotPath := fs.String("snapshot", "", "snapshot to fork, instead of running from the seed to -epoch")
+	switchLight := fs.Bool("switch-light", false, "make the pedestrian light of the fork change right away")
+	injectVehicle := fs.Int("inject-vehicle", -1, "vehicle lane on which the fork gets an extra vehicle")
+	updateScheme := fs.String("fork-update-scheme", "", fmt.Sprintf("update scheme of the fork %v", utils.UpdateSchemes))
+	stateDir := fs.String("state-dir", "", "directory where the snapshots of both runs at -until are written, if any")
+	fs.Parse(args)
+
+	scenarioCfg, err := sf.Load()
+	if err != nil {
+		return err
+	}
+	if *updateScheme != "" && !slices.Contains(utils.UpdateSchemes, *updateScheme) {
+		return fmt.Errorf("unknown update scheme %q, expected one of %v", *updateScheme, utils.UpdateSchemes)
+	}
+	var snapshot *model.Snapshot
+	if *snapshotPath != "" {
+		if snapshot, err = readSnapshot(*snapshotPath); err != nil {
+			return err
+		}
+		*seed = snapshot.Seed
+	}
+	streams, err := newStreams(scenarioCfg, *seed)
+	if err != nil {
+		return err
+	}
+	if *until == 0 {
+		*until = scenarioCfg.Replications.SimulationTime
+	}
+
+	original, err := model.NewAutomata(scenarioCfg.Model.Build(), streams)
+	if err != nil {
+		return err
+	}
+	if snapshot != nil {
+		if err := original.Restore(snapshot); err != nil {
+			return fmt.Errorf("%s: %w", *snapshotPath, err)
+		}
+	} else if err := original.AdvanceToContext(ctx, *epoch); err != nil {
+		return err
+	}
+
+	fork := original.Fork()
+	var changes []string
+	if *switchLight {
+		fork.PedestrianStopLight.Switch()
+		changes = append(changes, "switched the pedestrian light")
+	}
+	if *injectVehicle >= 0 {
+		if err := fork.InjectVehicle(*injectVehicle); err != nil {
+			return err
+		}
+		changes = append(changes, fmt.Sprintf("injected a vehicle on lane %d", *injectVehicle))
+	}
+	if *updateScheme != "" {
+		if fork.UpdateScheme, err = model.NewUpdateScheme(*updateScheme); err != nil {
+			return err
+		}
+		fork.Config.UpdateScheme = *updateScheme
+		changes = append(changes, "updated with the "+*updateScheme+" scheme")
+	}
+	if len(changes) == 0 {
+		changes = append(changes, "left unchanged")
+	}
+	fmt.Printf("Forked at epoch %d with %d conflicts, the fork %s\n", original.Epoch, original.Conflicts, strings.Join(changes, ", "))
+
+	if err := original.AdvanceToContext(ctx, *until); err != nil {
+		return err
+	}
+	if err := fork.AdvanceToContext(ctx, *until); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nAt epoch %d:\n%-22s %12s %12s %12s\n", *until, "metric", "original", "fork", "difference")
+	for _, metric := range metrics {
+		a, b := metric.Value(original), metric.Value(fork)
+		fmt.Printf("%-22s %12.4g %12.4g %+12.4g\n", metric.Name, a, b, b-a)
+	}
+	originalSnapshot, forkSnapshot := original.Snapshot(), fork.Snapshot()
+	diff := originalSnapshot.Diff(forkSnapshot)
+	fmt.Printf("\nAgents: %d only in the fork, %d only in the original, %d elsewhere in the fork, %d changed\n",
+		len(diff.Added), len(diff.Removed), len(diff.Moved), len(diff.Changed))
+
+	if *stateDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(*stateDir, 0755); err != nil {
+		return err
+	}
+	originalPath := snapshotFileName(*stateDir, *seed, *until)
+	forkPath := strings.TrimSuffix(originalPath, ".snapshot.json") + ".fork.snapshot.json"
+	if err := writeSnapshot(originalPath, originalSnapshot); err != nil {
+		return err
+	}
+	if err := writeSnapshot(forkPath, forkSnapshot); err != nil {
+		return err
+	}
+	fmt.Println("Snapshots saved in", originalPath, "and", forkPath)
+	return nil
+}
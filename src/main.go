@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"go_automata/src/utils"
+	"io/fs"
 	"os"
 	"os/exec"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -16,84 +22,249 @@ func CallClear() {
 	cmd.Run()
 }
 
-func linSpace(start, end float64, n int) []float64 {
-	step := (end - start) / float64(n)
-	result := make([]float64, 0)
-	for i := 0; i < n; i++ {
-		result = append(result, start+float64(i)*step)
+func startWorkers(ctx context.Context, scenarioCfg *ScenarioConfig, recorder ReplicationRecorder, inputCh chan Input, resultsCh chan *Result) *sync.WaitGroup {
+	workers := &sync.WaitGroup{}
+	for i := 0; i < scenarioCfg.Outputs.Goroutines; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(ctx, scenarioCfg, recorder, inputCh, resultsCh)
+		}()
 	}
-	return result
+	return workers
 }
 
-func buildConfigs(scenarioCfg *ScenarioConfig) []*utils.Config {
-	baseCfg := utils.NewConfigFromEnv()
-	configs := make([]*utils.Config, 0)
-	initialPedestrianArrivalRate := float64(scenarioCfg.InitialPedestrianArrivalRateHr) / (2 * 3600)
-	finalPedestrianArrivalRate := float64(scenarioCfg.FinalPedestrianArrivalRateHr) / (2 * 3600)
-	initialVehicleArrivalRate := float64(scenarioCfg.InitialVehicleArrivalRateHr) / (6 * 3600)
-	finalVehicleArrivalRate := float64(scenarioCfg.FinalVehicleArrivalRateHr) / (6 * 3600)
-
-	for _, pedestrianArrivalRate := range linSpace(initialPedestrianArrivalRate, finalPedestrianArrivalRate, 30) {
-		for _, vehicleArrivalRate := range linSpace(initialVehicleArrivalRate, finalVehicleArrivalRate, 30) {
-			configDup := baseCfg.Duplicate()
-			configDup.PedestrianArrivalRate = pedestrianArrivalRate
-			configDup.VehicleArrivalRate = vehicleArrivalRate
-			configs = append(configs, configDup)
+// saveResults writes the results to a file per format in the order of the
+// configurations, holding back the ones that arrive before some of their
+// predecessors, and returns the paths of the files, along with the
+// configurations that were abandoned. When ctx is done first, it waits for
+// the workers to stop, writes the results they had already sent, still in
+// order, and returns how many were saved with the error of ctx.
+func saveResults(ctx context.Context, sweep *Sweep, progress *Progress, workers *sync.WaitGroup, resultsCh chan *Result, expectedResults int) ([]string, []AbandonedConfig, int, error) {
+	writers := make([]ResultWriter, 0)
+	paths := make([]string, 0)
+	defer func() {
+		for _, w := range writers {
+			w.Close()
+		}
+	}()
+	for _, format := range sweep.cfg.Outputs.Formats {
+		path := resultsPath(sweep.cfg, format)
+		w, err := NewResultWriter(format, path, sweep)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		writers = append(writers, w)
+		paths = append(paths, path)
+	}
+
+	abandoned := make([]AbandonedConfig, 0)
+	saved := 0
+	write := func(r *Result) error {
+		if r.Err != nil {
+			abandoned = append(abandoned, AbandonedConfig{int(r.Index), r.Err.Error()})
+			return nil
+		}
+		saved++
+		record := sweep.Record(r)
+		for _, w := range writers {
+			if err := w.Write(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	pending := make(map[uint64]*Result)
+	var next uint64
+	receive := func(r *Result) error {
+		progress.ConfigurationDone(r)
+		pending[r.Index] = r
+		for pending[next] != nil {
+			r := pending[next]
+			delete(pending, next)
+			next++
+			if err := write(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var interrupted error
+	for i := 0; i < expectedResults && interrupted == nil; i++ {
+		select {
+		case r := <-resultsCh:
+			if err := receive(r); err != nil {
+				return nil, nil, 0, err
+			}
+		case <-ctx.Done():
+			interrupted = ctx.Err()
+		}
+	}
+	if interrupted != nil {
+		workers.Wait()
+		for len(resultsCh) > 0 {
+			if err := receive(<-resultsCh); err != nil {
+				return nil, nil, 0, err
+			}
+		}
+		// The configurations still missing leave gaps.
+		indices := make([]uint64, 0, len(pending))
+		for index := range pending {
+			indices = append(indices, index)
+		}
+		slices.Sort(indices)
+		for _, index := range indices {
+			if err := write(pending[index]); err != nil {
+				return nil, nil, 0, err
+			}
 		}
 	}
-	return configs
-}
 
-func startWorkers(scenarioCfg *ScenarioConfig, inputCh chan Input, resultsCh chan *Result) {
-	goRoutines := utils.GetEnvIntOrDefault("GOROUTINES", 20)
-	for i := 0; i < goRoutines; i++ {
-		go run(scenarioCfg, inputCh, resultsCh)
+	for _, w := range writers {
+		if err := w.Close(); err != nil {
+			return nil, nil, 0, err
+		}
 	}
+	writers = nil
+	return paths, abandoned, saved, interrupted
 }
 
-func saveResults(resultsCh chan *Result, expectedResults int) {
-	fileName := utils.GetEnvStr("RESULTS_FILE_NAME")
-	if fileName == nil {
-		t := time.Now()
-		defaultFileName := fmt.Sprintf("%d-%d-%d-%d-%d-%d.csv", t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second())
-		fileName = &defaultFileName
+// runSweep simulates every configuration of the sweep described by the
+// manifest and saves the results along with it. The manifest is saved before
+// starting, so that an interrupted sweep can be resumed from it, skipping the
+// replications its checkpoint already holds. When ctx is done, the results
+// finished so far are saved and the checkpoint is kept for resuming. With
+// coordinator flags that listen, the configurations are simulated by worker
+// processes instead of goroutines.
+func runSweep(ctx context.Context, manifest *Manifest, resume bool, coordinator *CoordinatorFlags) (*Manifest, error) {
+	scenarioCfg := manifest.Scenario
+	scenarioCfg.Print()
+	sweep, err := NewSweep(scenarioCfg)
+	if err != nil {
+		return nil, err
 	}
-	f, err := os.Create(fmt.Sprintf("results/%s", *fileName))
+	configs := sweep.Configs()
+	comparedConfigs := sweep.ComparedConfigs()
+
+	if err := os.MkdirAll(scenarioCfg.Outputs.Directory, 0o755); err != nil {
+		return nil, err
+	}
+	manifest.Configurations = sweep.Len()
+	manifest.Abandoned = nil
+	manifestPath := resultsPath(scenarioCfg, "manifest.yaml")
+	if err := manifest.Save(manifestPath); err != nil {
+		return nil, err
+	}
+	checkpoint, err := OpenCheckpoint(resultsPath(scenarioCfg, "checkpoint.jsonl"), scenarioCfg, resume)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	defer checkpoint.Close()
+	if resume {
+		fmt.Printf("Resuming with %d replications already finished\n", checkpoint.Finished())
 	}
-	defer f.Close()
 
-	f.WriteString("pedestrian_arrival_rate,vehicle_arrival_rate,conflicts\n")
+	inputCh := make(chan Input, 10000)
+	resultsCh := make(chan *Result, 10000)
+	progress, err := NewProgress(scenarioCfg, len(configs), checkpoint.Finished())
+	if err != nil {
+		return nil, err
+	}
+	recorder := progress.Recorder(checkpoint)
+	var workers *sync.WaitGroup
+	if coordinator != nil && coordinator.listen != "" {
+		workers, err = serveJobs(ctx, coordinator, scenarioCfg, recorder, inputCh, resultsCh)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		workers = startWorkers(ctx, scenarioCfg, recorder, inputCh, resultsCh)
+	}
 
-	for i := 0; i < expectedResults; i++ {
-		r := <-resultsCh
-		println("Received result", i)
-		f.WriteString(fmt.Sprintf("%d,%d,%f\n", int(r.PedestrianArrivalRate*2*3600), int(r.VehicleArrivalRate*6*3600), r.Conflicts))
+	go func() {
+		defer close(inputCh)
+		for i, config := range configs {
+			input := Input{i: uint64(i), config: config, done: checkpoint.Done(uint64(i))}
+			if comparedConfigs != nil {
+				input.compared = comparedConfigs[i]
+			}
+			select {
+			case inputCh <- input:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	paths, abandoned, saved, err := saveResults(ctx, sweep, progress, workers, resultsCh, len(configs))
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		progress.Finish("interrupted")
+		for _, path := range paths {
+			fmt.Printf("Partial results saved in %s\n", path)
+		}
+		return nil, fmt.Errorf("sweep interrupted with %d of %d configurations saved, continue it with: resume -manifest %s", saved, len(configs), manifestPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	workers.Wait()
+	if err := progress.Finish("finished"); err != nil {
+		return nil, err
+	}
+	for _, a := range abandoned {
+		fmt.Printf("Warning: configuration %d was abandoned: %s\n", a.Index, a.Reason)
+	}
+	manifest.Abandoned = abandoned
+	manifest.FinishedAt = time.Now()
+	for k, path := range paths {
+		if err := manifest.AddResult(scenarioCfg.Outputs.Formats[k], path); err != nil {
+			return nil, err
+		}
+		fmt.Printf("Results saved in %s\n", path)
 	}
+	if err := manifest.Save(manifestPath); err != nil {
+		return nil, err
+	}
+	fmt.Printf("Manifest saved in %s\n", manifestPath)
+	return manifest, checkpoint.Remove()
+}
 
-	fmt.Printf("Results saved in results/%s\n", *fileName)
+func exitWithErrors(errs []error) {
+	fmt.Fprintln(os.Stderr, "Invalid configuration:")
+	for _, err := range errs {
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, err := range joined.Unwrap() {
+				fmt.Fprintln(os.Stderr, "  -", err)
+			}
+		} else {
+			fmt.Fprintln(os.Stderr, "  -", err)
+		}
+	}
+	os.Exit(1)
 }
 
 func main() {
 	err := godotenv.Load()
-	if err != nil {
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		panic(err)
 	}
 
-	scenarioCfg := NewScenarioConfigFromEnv()
-	scenarioCfg.Print()
-	configs := buildConfigs(scenarioCfg)
-
-	inputCh := make(chan Input, 10000)
-	resultsCh := make(chan *Result, 10000)
-	startWorkers(scenarioCfg, inputCh, resultsCh)
+	// The first interrupt stops the sweep cleanly, a second one kills it.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
-	for i, config := range configs {
-		inputCh <- Input{uint64(i), config}
+	err = runCLI(ctx, os.Args[1:])
+	var configErrs ConfigErrors
+	if errors.As(err, &configErrs) {
+		exitWithErrors(configErrs)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
 	}
-	close(inputCh)
-
-	saveResults(resultsCh, len(configs))
-	close(resultsCh)
 }
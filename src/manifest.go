@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest records everything needed to reproduce a sweep: the resolved
+// scenario, how the seeds were derived, the code and toolchain that ran it,
+// where and when, and the files it produced.
+type Manifest struct {
+	Scenario       *ScenarioConfig   `yaml:"scenario"`
+	Configurations int               `yaml:"configurations"`
+	Seeds          SeedScheme        `yaml:"seeds"`
+	Results        []ResultFile      `yaml:"results"`
+	Abandoned      []AbandonedConfig `yaml:"abandoned,omitempty"`
+	Build          BuildInfo         `yaml:"build"`
+	Host           HostInfo          `yaml:"host"`
+	Command        []string          `yaml:"command"`
+	StartedAt      time.Time         `yaml:"started_at"`
+	ResumedAt      []time.Time       `yaml:"resumed_at,omitempty"`
+	FinishedAt     time.Time         `yaml:"finished_at,omitempty"`
+}
+
+// SeedScheme documents how the seed of every replication is derived. Each
+// run then splits its seed into named substreams.
+type SeedScheme struct {
+	Formula          string   `yaml:"formula"`
+	Base             uint64   `yaml:"base"`
+	PerConfiguration uint64   `yaml:"per_configuration"`
+	Antithetic       bool     `yaml:"antithetic"`
+	Substreams       []string `yaml:"substreams"`
+}
+
+type ResultFile struct {
+	Format string `yaml:"format"`
+	Path   string `yaml:"path"`
+	SHA256 string `yaml:"sha256"`
+}
+
+// AbandonedConfig is a configuration left out of the results because one of
+// its replications took longer than the run timeout.
+type AbandonedConfig struct {
+	Index  int    `yaml:"index"`
+	Reason string `yaml:"reason"`
+}
+
+type BuildInfo struct {
+	GoVersion    string   `yaml:"go_version"`
+	Module       string   `yaml:"module"`
+	Commit       string   `yaml:"commit"`
+	CommitTime   string   `yaml:"commit_time,omitempty"`
+	Modified     bool     `yaml:"modified"`
+	Dependencies []string `yaml:"dependencies"`
+}
+
+type HostInfo struct {
+	Hostname string `yaml:"hostname"`
+	OS       string `yaml:"os"`
+	Arch     string `yaml:"arch"`
+	CPUs     int    `yaml:"cpus"`
+}
+
+// NewManifest describes a sweep starting now. Sweeps without a results file
+// name get one from the time they start, so their manifest can find them.
+func NewManifest(cfg *ScenarioConfig) *Manifest {
+	start := time.Now()
+	if cfg.Outputs.ResultsFileName == "" {
+		cfg.Outputs.ResultsFileName = fmt.Sprintf("%d-%d-%d-%d-%d-%d", start.Year(), start.Month(), start.Day(), start.Hour(), start.Minute(), start.Second())
+	}
+	formula := "base + per_configuration * config_index + replication"
+	if cfg.Replications.Antithetic {
+		formula += " - replication % 2"
+	}
+	hostname, _ := os.Hostname()
+	return &Manifest{
+		Scenario: cfg,
+		Seeds: SeedScheme{
+			Formula:          formula,
+			Base:             seedBase,
+			PerConfiguration: seedsPerConfiguration,
+			Antithetic:       cfg.Replications.Antithetic,
+			Substreams:       []string{"update-order", "arrivals/<side>", "pedestrians/<side>", "pedestrians/<side>/attributes", "vehicles/lane<i>", "vehicles/lane<i>/attributes"},
+		},
+		Build:     readBuildInfo(),
+		Host:      HostInfo{hostname, runtime.GOOS, runtime.GOARCH, runtime.NumCPU()},
+		Command:   os.Args,
+		StartedAt: start,
+	}
+}
+
+// readBuildInfo reads the commit from the version control information
+// stamped by go build, asking git directly when it is missing (as with go
+// run).
+func readBuildInfo() BuildInfo {
+	b := BuildInfo{GoVersion: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if ok {
+		b.Module = info.Main.Path
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				b.Commit = setting.Value
+			case "vcs.time":
+				b.CommitTime = setting.Value
+			case "vcs.modified":
+				b.Modified = setting.Value == "true"
+			}
+		}
+		for _, dep := range info.Deps {
+			b.Dependencies = append(b.Dependencies, dep.Path+"@"+dep.Version)
+		}
+	}
+	if b.Commit == "" {
+		if out, err := exec.Command("git", "rev-parse", "HEAD").Output(); err == nil {
+			b.Commit = strings.TrimSpace(string(out))
+		}
+		if out, err := exec.Command("git", "status", "--porcelain").Output(); err == nil {
+			b.Modified = len(strings.TrimSpace(string(out))) > 0
+		}
+	}
+	return b
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (m *Manifest) AddResult(format, path string) error {
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	m.Results = append(m.Results, ResultFile{format, path, sum})
+	return nil
+}
+
+func (m *Manifest) Save(path string) error {
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{Scenario: DefaultScenarioConfig()}
+	if err := yaml.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
@@ -1,6 +1,9 @@
 package model
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"go_automata/src/generator"
 	"go_automata/src/grid"
 	"go_automata/src/utils"
@@ -8,7 +11,7 @@ import (
 
 type Automata struct {
 	Config              *utils.Config
-	Grid                *grid.Grid
+	Grid                *grid.Grid[RoadEntity]
 	CrosswalkZone       *utils.Rectangle
 	Epoch               int
 	Conflicts           int
@@ -16,17 +19,37 @@ type Automata struct {
 	VehicleLanes        []*VehicleLane
 	PedestrianStopLight *StopLight
 	Plotter             *Plotter
-	generator           generator.Generator
+	Metrics             *Metrics
+	Registry            *Registry
+	UpdateScheme        UpdateScheme
+	streams             *generator.Streams
+	recordEpochs        map[int]bool
+	states              map[int][]byte
+	snapshotEpochs      map[int]bool
+	snapshots           map[int]*Snapshot
 }
 
-func NewAutomata(config *utils.Config, generator generator.Generator) *Automata {
+// NewAutomata builds an automata from config, or from the environment if
+// config is nil, drawing its random numbers from streams.
+func NewAutomata(config *utils.Config, streams *generator.Streams) (*Automata, error) {
 	if config == nil {
-		config = utils.NewConfigFromEnv()
+		var err error
+		if config, err = utils.NewConfigFromEnv(); err != nil {
+			return nil, err
+		}
+	}
+	stopLight, err := NewStopLight(config.StopLightCycle, config.GreenLightTime, Green)
+	if err != nil {
+		return nil, err
+	}
+	updateScheme, err := NewUpdateScheme(config.UpdateScheme)
+	if err != nil {
+		return nil, err
 	}
 
 	totalRows := config.TotalRows()
 	totalCols := config.TotalCols()
-	grid := grid.NewGrid(totalRows, totalCols, generator)
+	grid := grid.NewGrid[RoadEntity](totalRows, totalCols)
 
 	crosswalkZone := utils.NewRectangle(config.CrosswalkProt.Rows(), config.CrosswalkProt.Cols())
 	crosswalkZone.MoveDown(config.VehicleProt.Rows())
@@ -38,15 +61,22 @@ func NewAutomata(config *utils.Config, generator generator.Generator) *Automata
 		CrosswalkZone:       crosswalkZone,
 		Epoch:               0,
 		Conflicts:           0,
-		PedestrianStopLight: NewStopLight(config.StopLightCycle, config.GreenLightTime, Green),
+		PedestrianStopLight: stopLight,
 		Plotter:             NewPlotter(grid, config),
-		generator:           generator,
+		Metrics:             NewMetrics(config.StopLightCycle),
+		Registry:            NewRegistry(streams.Get("update-order")),
+		UpdateScheme:        updateScheme,
+		streams:             streams,
+		recordEpochs:        make(map[int]bool),
+		states:              make(map[int][]byte),
+		snapshotEpochs:      make(map[int]bool),
+		snapshots:           make(map[int]*Snapshot),
 	}
 
 	automata.buildWaitingAreas()
 	automata.buildVehicleLanes()
 
-	return automata
+	return automata, nil
 }
 
 func (a *Automata) buildWaitingAreas() {
@@ -63,8 +93,8 @@ func (a *Automata) buildWaitingAreas() {
 	gridAreaEast := grid.NewRelativeGrid(walkingZone.LowerRight, walkingZone, utils.West, a.Grid)
 
 	a.WaitingAreas = []*WaitingArea{
-		NewWaitingArea(a.Config.PedestrianArrivalRate, gridAreaWest, 100, a.generator),
-		NewWaitingArea(a.Config.PedestrianArrivalRate, gridAreaEast, 100, a.generator),
+		NewWaitingArea(a.Config.PedestrianArrivalRate, gridAreaWest, 100, a.streams.Get("arrivals/west"), a.streams.Get("pedestrians/west"), a.streams.Get("pedestrians/west/attributes"), a.Metrics, a.Registry),
+		NewWaitingArea(a.Config.PedestrianArrivalRate, gridAreaEast, 100, a.streams.Get("arrivals/east"), a.streams.Get("pedestrians/east"), a.streams.Get("pedestrians/east/attributes"), a.Metrics, a.Registry),
 	}
 }
 
@@ -85,54 +115,159 @@ func (a *Automata) buildVehicleLanes() {
 		}
 
 		grid := grid.NewRelativeGrid(origin, vehicleLaneZone, facing, a.Grid)
+		arrivals := a.streams.Get(fmt.Sprintf("vehicles/lane%d", i))
+		attributes := a.streams.Get(fmt.Sprintf("vehicles/lane%d/attributes", i))
 
 		var vehicleLane *VehicleLane
 		if i == 0 || i == vehicleLanesAmount-1 {
-			vehicleLane = NewVehicleLane(a.Config, grid, true, a.generator)
+			vehicleLane = NewVehicleLane(a.Config, grid, true, arrivals, attributes, a.Metrics, a.Registry)
 		} else {
-			vehicleLane = NewVehicleLane(a.Config, grid, false, a.generator)
+			vehicleLane = NewVehicleLane(a.Config, grid, false, arrivals, attributes, a.Metrics, a.Registry)
 		}
 		a.VehicleLanes = append(a.VehicleLanes, vehicleLane)
 	}
 }
 
 func (a *Automata) Update() {
+	a.RecordState()
+	a.Metrics.beginEpoch(a.Epoch)
 	a.PedestrianStopLight.Update()
 	for _, waitingArea := range a.WaitingAreas {
 		waitingArea.Update(a.PedestrianStopLight)
 	}
 
-	a.Grid.Apply(func(entity interface{}) {
-		roadEntity := entity.(RoadEntity)
-		roadEntity.Think(a.CrosswalkZone, a.PedestrianStopLight)
-	})
-
-	a.Grid.Apply(func(entity interface{}) {
-		roadEntity := entity.(RoadEntity)
-		conflictHappened := roadEntity.Move(a.CrosswalkZone)
-		if conflictHappened {
-			a.Conflicts++
-		}
-	})
+	a.UpdateScheme.Update(a)
 
 	for _, vehicleLane := range a.VehicleLanes {
 		vehicleLane.Update()
 	}
 
+	a.Metrics.endEpoch(a.WaitingAreas, a.VehicleLanes)
 	a.Epoch++
 }
 
+func (a *Automata) think(entity RoadEntity) {
+	entity.Think(a.CrosswalkZone, a.PedestrianStopLight)
+}
+
+func (a *Automata) move(entity RoadEntity) {
+	if entity.Move(a.CrosswalkZone) {
+		a.conflict()
+	}
+}
+
+func (a *Automata) conflict() {
+	a.Conflicts++
+	a.Metrics.conflict()
+}
+
 func (a *Automata) Show() {
 	println("Epoch:", a.Epoch)
 	println("Conflicts:", a.Conflicts)
 	a.PedestrianStopLight.Show()
 	println("Waiting at East:", a.WaitingAreas[0].waiting_pedestrians)
 	println("Waiting at West:", a.WaitingAreas[1].waiting_pedestrians)
+	fmt.Printf("Pedestrian delay: %.1f s, Crossing time: %.1f s, Vehicle delay: %.1f s, Violations: %d, Dropped: %d\n",
+		a.Metrics.MeanPedestrianDelay(), a.Metrics.MeanCrossingTime(), a.Metrics.MeanVehicleDelay(),
+		a.Metrics.RedLightViolations, a.Metrics.PedestriansDropped)
 	a.Plotter.Plot()
 }
 
+// contextCheckInterval is how many epochs AdvanceToContext simulates between
+// checks of its context.
+const contextCheckInterval = 50
+
 func (a *Automata) AdvanceTo(epoch int) {
+	a.AdvanceToContext(context.Background(), epoch)
+}
+
+// AdvanceToContext is AdvanceTo, stopping early with the error of ctx once
+// it is cancelled or its deadline passes.
+func (a *Automata) AdvanceToContext(ctx context.Context, epoch int) error {
 	for a.Epoch < epoch {
+		if a.Epoch%contextCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
 		a.Update()
 	}
+	a.RecordState()
+	return nil
+}
+
+// RecordStateAt makes the automata save its whole state, the state of its
+// random streams included, when it reaches each of the given epochs, before
+// updating. NewAutomataAt resumes the run from a saved state.
+func (a *Automata) RecordStateAt(epochs ...int) {
+	for _, epoch := range epochs {
+		a.recordEpochs[epoch] = true
+	}
+	a.RecordState()
+}
+
+// RecordSnapshotAt makes the automata take a snapshot when it reaches each
+// of the given epochs, before updating.
+func (a *Automata) RecordSnapshotAt(epochs ...int) {
+	for _, epoch := range epochs {
+		a.snapshotEpochs[epoch] = true
+	}
+	a.RecordState()
+}
+
+// RecordState saves the state and takes the snapshot due at the current
+// epoch, if any. Update does it before every epoch and AdvanceTo once
+// the last one is reached; a caller stepping through Update itself calls it
+// after the last update.
+func (a *Automata) RecordState() {
+	if a.recordEpochs[a.Epoch] {
+		var buf bytes.Buffer
+		if err := a.Snapshot().Write(&buf); err != nil {
+			panic(fmt.Sprintf("could not encode the state at epoch %d: %v", a.Epoch, err))
+		}
+		a.states[a.Epoch] = buf.Bytes()
+	}
+	if a.snapshotEpochs[a.Epoch] {
+		a.snapshots[a.Epoch] = a.Snapshot()
+	}
+}
+
+func (a *Automata) RecordedSnapshot(epoch int) (*Snapshot, bool) {
+	s, ok := a.snapshots[epoch]
+	return s, ok
+}
+
+// RecordedState returns the state saved at the given epoch.
+func (a *Automata) RecordedState(epoch int) ([]byte, bool) {
+	state, ok := a.states[epoch]
+	return state, ok
+}
+
+func (a *Automata) SaveGeneratorState() []byte {
+	return a.streams.Save()
+}
+
+func (a *Automata) RestoreGeneratorState(state []byte) error {
+	return a.streams.Restore(state)
+}
+
+// NewAutomataAt resumes a run at the given epoch from the state it saved
+// there, without simulating the epochs before it, so that it goes on exactly
+// as the original run did.
+func NewAutomataAt(config *utils.Config, streams *generator.Streams, epoch int, state []byte) (*Automata, error) {
+	snapshot, err := ReadSnapshot(bytes.NewReader(state))
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.Epoch != epoch {
+		return nil, fmt.Errorf("the state was saved at epoch %d, not %d", snapshot.Epoch, epoch)
+	}
+	automata, err := NewAutomata(config, streams)
+	if err != nil {
+		return nil, err
+	}
+	if err := automata.Restore(snapshot); err != nil {
+		return nil, err
+	}
+	return automata, nil
 }
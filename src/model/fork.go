@@ -0,0 +1,36 @@
+package model
+
+import "fmt"
+
+// injectedRepr shows the vehicles placed by InjectVehicle.
+const injectedRepr = "⬜"
+
+// Fork returns an independent copy of the automata, down to the state of its
+// random streams, which goes on exactly as the automata does until one of
+// them is changed.
+func (a *Automata) Fork() *Automata {
+	fork, err := NewAutomata(a.Config.Duplicate(), a.streams.Clone())
+	if err == nil {
+		fork.UpdateScheme = a.UpdateScheme
+		err = fork.Restore(a.Snapshot())
+	}
+	if err != nil {
+		panic(fmt.Sprintf("a fork could not restore its own automata: %v", err))
+	}
+	return fork
+}
+
+// InjectVehicle places an extra vehicle at the start of a lane, as if one
+// had just arrived and found room there. It draws no random number, so the
+// arrivals that follow are the same as without it.
+func (a *Automata) InjectVehicle(lane int) error {
+	if lane < 0 || lane >= len(a.VehicleLanes) {
+		return fmt.Errorf("there is no vehicle lane %d, the lanes go from 0 to %d", lane, len(a.VehicleLanes)-1)
+	}
+	vl := a.VehicleLanes[lane]
+	if !vl.canPlaceVehicle() {
+		return fmt.Errorf("the start of vehicle lane %d is taken", lane)
+	}
+	vl.register(newVehicle(vl.origin(), a.Config.VehicleProt, vl.turning, injectedRepr, vl.attributes))
+	return nil
+}
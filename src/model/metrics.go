@@ -0,0 +1,176 @@
+package model
+
+// CycleMetrics holds what happened during one cycle of the pedestrian stop
+// light, starting with its green phase.
+type CycleMetrics struct {
+	Cycle              int
+	PedestriansCrossed int
+	VehiclesPassed     int
+	Conflicts          int
+	RedLightViolations int
+	PedestriansDropped int
+}
+
+// Throughput is the number of pedestrians and vehicles that got through the
+// crosswalk during the cycle.
+func (c *CycleMetrics) Throughput() int {
+	return c.PedestriansCrossed + c.VehiclesPassed
+}
+
+// Metrics collects the measures of performance of a run. The entities report
+// their events to it as they happen, and the automata samples the queues at
+// the end of every epoch. Times are measured in epochs.
+type Metrics struct {
+	epoch       int
+	cycleLength int
+
+	Epochs int
+
+	// Pedestrians are delayed from their arrival at the waiting area until
+	// they step onto the crosswalk, and take CrossingTime to reach the other
+	// side. Pedestrians that arrive when their waiting area has no room left
+	// are dropped.
+	PedestriansArrived int
+	PedestriansDropped int
+	PedestriansStarted int
+	PedestriansCrossed int
+	PedestrianDelay    int
+	CrossingTime       int
+
+	// Vehicles are delayed from the moment they reach the stop line until
+	// they start moving through the crosswalk.
+	VehiclesStarted int
+	VehiclesPassed  int
+	VehicleDelay    int
+
+	// Queues are sampled at the end of every epoch: vehicles waiting to enter
+	// each lane and pedestrians waiting to enter each walking zone.
+	VehicleQueue       int
+	MaxVehicleQueue    int
+	PedestrianQueue    int
+	MaxPedestrianQueue int
+	vehicleSamples     int
+	pedestrianSamples  int
+
+	// Pedestrians still on the crosswalk when their light turns red, and
+	// vehicles going straight still on it when the pedestrians' light turns
+	// green. Each entity is counted once.
+	RedLightViolations int
+
+	Cycles []*CycleMetrics
+}
+
+func NewMetrics(cycleLength int) *Metrics {
+	m := &Metrics{cycleLength: cycleLength}
+	m.beginEpoch(0)
+	return m
+}
+
+// Epoch returns the epoch being simulated.
+func (m *Metrics) Epoch() int {
+	return m.epoch
+}
+
+func (m *Metrics) beginEpoch(epoch int) {
+	m.epoch = epoch
+	for len(m.Cycles) <= epoch/m.cycleLength {
+		m.Cycles = append(m.Cycles, &CycleMetrics{Cycle: len(m.Cycles)})
+	}
+}
+
+func (m *Metrics) cycle() *CycleMetrics {
+	return m.Cycles[m.epoch/m.cycleLength]
+}
+
+func (m *Metrics) endEpoch(waitingAreas []*WaitingArea, vehicleLanes []*VehicleLane) {
+	m.Epochs++
+	for _, vehicleLane := range vehicleLanes {
+		m.VehicleQueue += vehicleLane.waitingVehicles
+		m.MaxVehicleQueue = max(m.MaxVehicleQueue, vehicleLane.waitingVehicles)
+		m.vehicleSamples++
+	}
+	for _, waitingArea := range waitingAreas {
+		m.PedestrianQueue += waitingArea.waiting_pedestrians
+		m.MaxPedestrianQueue = max(m.MaxPedestrianQueue, waitingArea.waiting_pedestrians)
+		m.pedestrianSamples++
+	}
+}
+
+func (m *Metrics) pedestriansArrived(arrived, dropped int) {
+	m.PedestriansArrived += arrived
+	m.PedestriansDropped += dropped
+	m.cycle().PedestriansDropped += dropped
+}
+
+func (m *Metrics) pedestrianStarted(arrivedAt int) {
+	m.PedestriansStarted++
+	m.PedestrianDelay += m.epoch - arrivedAt
+}
+
+func (m *Metrics) pedestrianCrossed(startedAt int) {
+	m.PedestriansCrossed++
+	m.CrossingTime += m.epoch - startedAt
+	m.cycle().PedestriansCrossed++
+}
+
+func (m *Metrics) vehicleStarted(placedAt int) {
+	m.VehiclesStarted++
+	m.VehicleDelay += m.epoch - placedAt
+}
+
+func (m *Metrics) vehiclePassed() {
+	m.VehiclesPassed++
+	m.cycle().VehiclesPassed++
+}
+
+func (m *Metrics) redLightViolation() {
+	m.RedLightViolations++
+	m.cycle().RedLightViolations++
+}
+
+func (m *Metrics) conflict() {
+	m.cycle().Conflicts++
+}
+
+func ratio(total, count int) float64 {
+	if count == 0 {
+		return 0
+	}
+	return float64(total) / float64(count)
+}
+
+// MeanPedestrianDelay is the mean time pedestrians waited before crossing.
+func (m *Metrics) MeanPedestrianDelay() float64 {
+	return ratio(m.PedestrianDelay, m.PedestriansStarted)
+}
+
+// MeanCrossingTime is the mean time pedestrians took to cross.
+func (m *Metrics) MeanCrossingTime() float64 {
+	return ratio(m.CrossingTime, m.PedestriansCrossed)
+}
+
+// MeanVehicleDelay is the mean time vehicles waited at the stop line.
+func (m *Metrics) MeanVehicleDelay() float64 {
+	return ratio(m.VehicleDelay, m.VehiclesStarted)
+}
+
+// MeanVehicleQueue is the mean number of vehicles waiting to enter a lane.
+func (m *Metrics) MeanVehicleQueue() float64 {
+	return ratio(m.VehicleQueue, m.vehicleSamples)
+}
+
+// MeanPedestrianQueue is the mean number of pedestrians waiting at a
+// waiting area.
+func (m *Metrics) MeanPedestrianQueue() float64 {
+	return ratio(m.PedestrianQueue, m.pedestrianSamples)
+}
+
+// MeanThroughput is the mean number of pedestrians and vehicles that got
+// through the crosswalk per complete signal cycle.
+func (m *Metrics) MeanThroughput() float64 {
+	total, cycles := 0, m.Epochs/m.cycleLength
+	for _, cycle := range m.Cycles[:cycles] {
+		total += cycle.Throughput()
+	}
+	return ratio(total, cycles)
+}
@@ -8,14 +8,21 @@ import (
 
 type Pedestrian struct {
 	desired_displacement *utils.RelativePosition
-	rel_grid             *grid.RelativeGrid
+	rel_grid             *grid.RelativeGrid[RoadEntity]
 	crossing             bool
 	vel                  int
 	repr                 string
 	generator            generator.Generator
+	metrics              *Metrics
+	registry             *Registry
+	arrived_at           int
+	started_at           int
+	caught_on_red        bool
+	starting             bool
+	leaving              bool
 }
 
-func NewPedestrian(rel_grid *grid.RelativeGrid, velocity int, repr string, generator generator.Generator) *Pedestrian {
+func NewPedestrian(rel_grid *grid.RelativeGrid[RoadEntity], velocity int, repr string, generator generator.Generator) *Pedestrian {
 	p := &Pedestrian{rel_grid: rel_grid, crossing: false, generator: generator}
 	p.desired_displacement = utils.Still()
 
@@ -44,6 +51,10 @@ func (p *Pedestrian) IsVehicle() bool {
 	return false
 }
 
+func (p *Pedestrian) AsPedestrian() *Pedestrian {
+	return p
+}
+
 func (p *Pedestrian) IsCrossing() bool {
 	return p.crossing
 }
@@ -68,19 +79,21 @@ func (p *Pedestrian) generateVelocity() int {
 	}
 }
 
+// crossingPedestrian matches the cells of pedestrians crossing towards the
+// given direction.
+func crossingPedestrian(facing utils.Direction) func(RoadEntity) bool {
+	return func(ent RoadEntity) bool {
+		pedestrian := ent.AsPedestrian()
+		return pedestrian != nil && pedestrian.IsCrossing() && pedestrian.Facing() == facing
+	}
+}
+
 func (p *Pedestrian) CanMoveForward() bool {
 	if !p.rel_grid.IsInbounds(utils.Forward(1)) {
 		return true
 	}
 
-	dist_to_next := p.rel_grid.CalcDistToNext(utils.Still(), func(ent interface{}) bool {
-		switch pedestrian := ent.(type) {
-		case *Pedestrian:
-			return pedestrian.IsCrossing() && pedestrian.Facing() == p.Facing()
-		default:
-			return false
-		}
-	}, 1)
+	dist_to_next := p.rel_grid.CalcDistToNext(utils.Still(), crossingPedestrian(p.Facing()), 1)
 
 	return dist_to_next == -1
 }
@@ -103,43 +116,21 @@ func (p *Pedestrian) CanDoLateralMovement(toRight bool) bool {
 		return false
 	}
 
-	dist := p.rel_grid.CalcDistToNext(displacement, func(ent interface{}) bool {
-		switch pedestrian := ent.(type) {
-		case *Pedestrian:
-			return pedestrian.IsCrossing() && pedestrian.Facing() == utils.OppositeDirection(p.Facing())
-		default:
-			return false
-		}
-
-	}, p.vel)
+	dist := p.rel_grid.CalcDistToNext(displacement, crossingPedestrian(utils.OppositeDirection(p.Facing())), p.vel)
 
 	if dist != -1 {
 		return false
 	}
 
-	dist_to_prev := p.rel_grid.CalcDistToPrev(displacement, func(ent interface{}) bool {
-		switch pedestrian := ent.(type) {
-		case *Pedestrian:
-			return pedestrian.IsCrossing() && pedestrian.Facing() == p.Facing()
-		default:
-			return false
-		}
-	}, 6)
+	dist_to_prev := p.rel_grid.CalcDistToPrev(displacement, crossingPedestrian(p.Facing()), 6)
 
 	if dist_to_prev == -1 {
 		return true
 	}
 
-	prev := p.rel_grid.GetPrev(displacement, func(ent interface{}) bool {
-		switch pedestrian := ent.(type) {
-		case *Pedestrian:
-			return pedestrian.IsCrossing() && pedestrian.Facing() == p.Facing()
-		default:
-			return false
-		}
-	}, 6)
+	prev := p.rel_grid.GetPrev(displacement, crossingPedestrian(p.Facing()), 6)
 
-	return prev.(*Pedestrian).vel < p.vel
+	return prev.AsPedestrian().vel < p.vel
 }
 
 func (p *Pedestrian) CanMoveLeft() bool {
@@ -151,14 +142,7 @@ func (p *Pedestrian) CanMoveRight() bool {
 }
 
 func (p *Pedestrian) GetPosForward() *utils.RelativePosition {
-	dist_to_next := p.rel_grid.CalcDistToNext(utils.Still(), func(ent interface{}) bool {
-		switch pedestrian := ent.(type) {
-		case *Pedestrian:
-			return pedestrian.IsCrossing() && pedestrian.Facing() == p.Facing()
-		default:
-			return false
-		}
-	}, 0)
+	dist_to_next := p.rel_grid.CalcDistToNext(utils.Still(), crossingPedestrian(p.Facing()), 0)
 
 	if dist_to_next == -1 || dist_to_next > p.vel {
 		return utils.Forward(p.vel)
@@ -184,6 +168,10 @@ func (p *Pedestrian) Think(crosswalkZone *utils.Rectangle, pedestrianStopLight *
 		} else {
 			p.vel = 6
 			p.repr = "😰"
+			if !p.caught_on_red {
+				p.caught_on_red = true
+				p.metrics.redLightViolation()
+			}
 		}
 	}
 
@@ -206,8 +194,19 @@ func (p *Pedestrian) Think(crosswalkZone *utils.Rectangle, pedestrianStopLight *
 }
 
 func (p *Pedestrian) Move(crosswalkZone *utils.Rectangle) bool {
+	p.plan(crosswalkZone)
+	p.apply()
+	return false
+}
+
+// plan settles the move decided by Think on the grid as it is: whether the
+// pedestrian steps onto the crosswalk, whether it leaves the walking zone
+// and otherwise how far it gets before the first occupied cell. Pedestrians
+// never cause conflicts.
+func (p *Pedestrian) plan(crosswalkZone *utils.Rectangle) bool {
+	p.starting, p.leaving = false, false
 	if !p.rel_grid.IsInbounds(p.desired_displacement) {
-		p.rel_grid.Clear(utils.Still())
+		p.leaving = true
 		return false
 	}
 
@@ -215,24 +214,57 @@ func (p *Pedestrian) Move(crosswalkZone *utils.Rectangle) bool {
 		return false
 	}
 
-	p.crossing = true
+	p.starting = !p.crossing
 	if !p.rel_grid.NewDisplaced(p.desired_displacement).IsIn(crosswalkZone) {
-		p.rel_grid.Clear(utils.Still())
+		p.leaving = true
 		return false
 	}
 
 	for !p.desired_displacement.IsStill() && p.rel_grid.IsFill(p.desired_displacement) {
 		p.desired_displacement.Decrease()
 	}
+	return false
+}
 
-	if p.desired_displacement.IsStill() {
-		return false
+// claims returns the cell the planned move takes, if any.
+func (p *Pedestrian) claims() []utils.Point {
+	if p.leaving || p.desired_displacement.IsStill() {
+		return nil
 	}
+	return []utils.Point{p.rel_grid.Position(p.desired_displacement)}
+}
 
-	p.rel_grid.Move(p.desired_displacement)
+// yield gives up the planned move and stays in place. A pedestrian that was
+// about to step onto the crosswalk keeps waiting, its start is recorded when
+// it does move.
+func (p *Pedestrian) yield(crosswalkZone *utils.Rectangle, winner planner) bool {
+	p.desired_displacement = utils.Still()
+	p.starting = false
 	return false
 }
 
+// apply carries out the planned move.
+func (p *Pedestrian) apply() {
+	if p.starting {
+		p.crossing = true
+		p.started_at = p.metrics.Epoch()
+		p.metrics.pedestrianStarted(p.arrived_at)
+	}
+	if p.leaving {
+		p.leave()
+		return
+	}
+	p.rel_grid.Move(p.desired_displacement)
+}
+
+func (p *Pedestrian) leave() {
+	p.rel_grid.Clear(utils.Still())
+	p.registry.Remove(p)
+	if p.crossing {
+		p.metrics.pedestrianCrossed(p.started_at)
+	}
+}
+
 func (p *Pedestrian) Repr() string {
 	return p.repr
 }
@@ -57,13 +57,13 @@ class Plotter:
 
 type Plotter struct {
 	config           *utils.Config
-	grid             *grid.Grid
+	grid             *grid.Grid[RoadEntity]
 	bounds           *utils.Rectangle
 	crosswalkZone    *utils.Rectangle
 	waitingAreaZones []*utils.Rectangle
 }
 
-func NewPlotter(grid *grid.Grid, config *utils.Config) *Plotter {
+func NewPlotter(grid *grid.Grid[RoadEntity], config *utils.Config) *Plotter {
 	crosswalkStartRow := config.VehicleProt.Rows()
 	crosswalkStartCol := config.WaitingAreaProt.Cols()
 
@@ -97,7 +97,7 @@ func (p *Plotter) Plot() {
 	p.grid.Plot(p.plotObject, p.bounds)
 }
 
-func (p *Plotter) plotObject(point *utils.Point, obj interface{}) string {
+func (p *Plotter) plotObject(point *utils.Point, obj RoadEntity) string {
 	if obj == nil {
 		for _, waitingAreaZone := range p.waitingAreaZones {
 			if waitingAreaZone.IsInside(point) {
@@ -111,7 +111,6 @@ func (p *Plotter) plotObject(point *utils.Point, obj interface{}) string {
 			return "⬛"
 		}
 	} else {
-		e := obj.(RoadEntity)
-		return e.Repr()
+		return obj.Repr()
 	}
 }
@@ -0,0 +1,92 @@
+package model
+
+import "go_automata/src/generator"
+
+// Registry keeps track of the agents on the grid, the pedestrians and
+// vehicles but not the parts of the vehicles, as they are placed and leave,
+// so that updating them never scans the grid. Every agent gets an ID, in
+// the order they are added, that snapshots identify it by.
+type Registry struct {
+	agents    []RoadEntity
+	positions map[RoadEntity]int
+	ids       map[RoadEntity]int
+	nextID    int
+	order     []RoadEntity
+	generator generator.Generator
+}
+
+// NewRegistry returns an empty registry whose updates visit the agents in
+// an order drawn from generator.
+func NewRegistry(generator generator.Generator) *Registry {
+	return &Registry{positions: make(map[RoadEntity]int), ids: make(map[RoadEntity]int), generator: generator}
+}
+
+func (r *Registry) Add(agent RoadEntity) {
+	r.add(agent, r.nextID)
+	r.nextID++
+}
+
+func (r *Registry) add(agent RoadEntity, id int) {
+	r.positions[agent] = len(r.agents)
+	r.ids[agent] = id
+	r.agents = append(r.agents, agent)
+}
+
+// ID returns the ID of a registered agent.
+func (r *Registry) ID(agent RoadEntity) int {
+	return r.ids[agent]
+}
+
+// reset forgets every agent, the next one added getting nextID.
+func (r *Registry) reset(nextID int) {
+	clear(r.agents)
+	r.agents = r.agents[:0]
+	clear(r.positions)
+	clear(r.ids)
+	r.nextID = nextID
+}
+
+// Remove forgets an agent in constant time, moving the last agent into its
+// place.
+func (r *Registry) Remove(agent RoadEntity) {
+	pos, ok := r.positions[agent]
+	if !ok {
+		panic("Attempted to remove an agent that is not registered")
+	}
+	last := len(r.agents) - 1
+	r.agents[pos] = r.agents[last]
+	r.positions[r.agents[pos]] = pos
+	r.agents[last] = nil
+	r.agents = r.agents[:last]
+	delete(r.positions, agent)
+	delete(r.ids, agent)
+}
+
+func (r *Registry) Len() int {
+	return len(r.agents)
+}
+
+// Agents returns the registered agents. The slice must not be modified.
+func (r *Registry) Agents() []RoadEntity {
+	return r.agents
+}
+
+// Shuffle returns the agents registered when it is called in a random order
+// given by a Fisher–Yates shuffle. The slice is only valid until the next
+// call, and it is not changed as agents leave or are placed.
+func (r *Registry) Shuffle() []RoadEntity {
+	r.order = append(r.order[:0], r.agents...)
+	for i := len(r.order) - 1; i > 0; i-- {
+		j := r.generator.RandInt(0, i+1)
+		r.order[i], r.order[j] = r.order[j], r.order[i]
+	}
+	return r.order
+}
+
+// Apply calls f on every agent registered when it is called, in the order of
+// Shuffle. Agents may leave, or place others, while it runs.
+func (r *Registry) Apply(f func(RoadEntity)) {
+	for _, agent := range r.Shuffle() {
+		f(agent)
+	}
+}
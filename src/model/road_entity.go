@@ -7,5 +7,8 @@ type RoadEntity interface {
 	Think(crosswalkZone *utils.Rectangle, pedestrianStopLight *StopLight)
 	Move(crosswalkZone *utils.Rectangle) bool
 	IsVehicle() bool
+	// AsPedestrian returns the entity as a pedestrian, nil for the other
+	// entities, so that cells can be read without type switches.
+	AsPedestrian() *Pedestrian
 	Repr() string
 }
@@ -0,0 +1,405 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"go_automata/src/utils"
+	"io"
+	"slices"
+	"strings"
+)
+
+// SnapshotVersion is the version of the Snapshot format. It changes whenever
+// older snapshots would no longer restore to the state they were taken from.
+const SnapshotVersion = 2
+
+const (
+	PedestrianKind = "pedestrian"
+	VehicleKind    = "vehicle"
+)
+
+// Snapshot is the whole state of an automata at the start of an epoch: the
+// stop light, the queues, the agents on the grid in the order the registry
+// keeps them, the metrics so far and the state of the random streams. An
+// automata of the same configuration restored from it runs exactly as the
+// one it was taken from.
+type Snapshot struct {
+	Version      int                   `json:"version"`
+	Seed         uint64                `json:"seed"`
+	Epoch        int                   `json:"epoch"`
+	Rows         int                   `json:"rows"`
+	Cols         int                   `json:"cols"`
+	Conflicts    int                   `json:"conflicts"`
+	StopLight    StopLightSnapshot     `json:"stop_light"`
+	WaitingAreas []WaitingAreaSnapshot `json:"waiting_areas"`
+	VehicleLanes []VehicleLaneSnapshot `json:"vehicle_lanes"`
+	Agents       []AgentSnapshot       `json:"agents"`
+	NextAgentID  int                   `json:"next_agent_id"`
+	Metrics      MetricsSnapshot       `json:"metrics"`
+	Generators   json.RawMessage       `json:"generators"`
+}
+
+type StopLightSnapshot struct {
+	Green        bool `json:"green"`
+	TimeToChange int  `json:"time_to_change"`
+}
+
+// WaitingAreaSnapshot holds the pedestrians that arrived at a waiting area
+// but are not on the grid yet, by the epoch they arrived at.
+type WaitingAreaSnapshot struct {
+	Waiting   int   `json:"waiting"`
+	ArrivedAt []int `json:"arrived_at"`
+}
+
+type VehicleLaneSnapshot struct {
+	Waiting int `json:"waiting"`
+}
+
+// AgentSnapshot is a pedestrian, which came from the waiting area Source, or
+// a vehicle, which drives on the lane Source with its driver at Row and Col.
+type AgentSnapshot struct {
+	ID       int    `json:"id"`
+	Kind     string `json:"kind"`
+	Source   int    `json:"source"`
+	Row      int    `json:"row"`
+	Col      int    `json:"col"`
+	Velocity int    `json:"velocity"`
+	Repr     string `json:"repr"`
+	Crossing bool   `json:"crossing"`
+
+	ArrivedAt   int  `json:"arrived_at,omitempty"`
+	StartedAt   int  `json:"started_at,omitempty"`
+	CaughtOnRed bool `json:"caught_on_red,omitempty"`
+
+	Turning  bool `json:"turning,omitempty"`
+	PlacedAt int  `json:"placed_at,omitempty"`
+	Violated bool `json:"violated,omitempty"`
+}
+
+// MetricsSnapshot is the state of Metrics, along with the number of queue
+// samples its means are taken over.
+type MetricsSnapshot struct {
+	Epoch             int     `json:"epoch"`
+	Measures          Metrics `json:"measures"`
+	VehicleSamples    int     `json:"vehicle_samples"`
+	PedestrianSamples int     `json:"pedestrian_samples"`
+}
+
+func cloneCycles(cycles []*CycleMetrics) []*CycleMetrics {
+	cloned := make([]*CycleMetrics, len(cycles))
+	for i, cycle := range cycles {
+		c := *cycle
+		cloned[i] = &c
+	}
+	return cloned
+}
+
+func (m *Metrics) snapshot() MetricsSnapshot {
+	s := MetricsSnapshot{Epoch: m.epoch, Measures: *m, VehicleSamples: m.vehicleSamples, PedestrianSamples: m.pedestrianSamples}
+	s.Measures.Cycles = cloneCycles(m.Cycles)
+	return s
+}
+
+func (m *Metrics) restore(s MetricsSnapshot) {
+	cycleLength := m.cycleLength
+	*m = s.Measures
+	m.Cycles = cloneCycles(s.Measures.Cycles)
+	m.cycleLength = cycleLength
+	m.epoch = s.Epoch
+	m.vehicleSamples = s.VehicleSamples
+	m.pedestrianSamples = s.PedestrianSamples
+}
+
+// Snapshot returns the state of the automata.
+func (a *Automata) Snapshot() *Snapshot {
+	light := a.PedestrianStopLight
+	s := &Snapshot{
+		Version:     SnapshotVersion,
+		Seed:        a.streams.Seed(),
+		Epoch:       a.Epoch,
+		Rows:        a.Grid.Rows(),
+		Cols:        a.Grid.Cols(),
+		Conflicts:   a.Conflicts,
+		StopLight:   StopLightSnapshot{light.IsGreen(), light.timeToChange},
+		NextAgentID: a.Registry.nextID,
+		Metrics:     a.Metrics.snapshot(),
+		Generators:  a.streams.Save(),
+	}
+	for _, wa := range a.WaitingAreas {
+		s.WaitingAreas = append(s.WaitingAreas, WaitingAreaSnapshot{wa.waiting_pedestrians, slices.Clone(wa.arrived_at)})
+	}
+	for _, vl := range a.VehicleLanes {
+		s.VehicleLanes = append(s.VehicleLanes, VehicleLaneSnapshot{vl.waitingVehicles})
+	}
+	for _, agent := range a.Registry.Agents() {
+		s.Agents = append(s.Agents, a.agentSnapshot(agent))
+	}
+	return s
+}
+
+func (a *Automata) agentSnapshot(agent RoadEntity) AgentSnapshot {
+	s := AgentSnapshot{ID: a.Registry.ID(agent)}
+	switch agent := agent.(type) {
+	case *Pedestrian:
+		position := agent.rel_grid.Position(utils.Still())
+		s.Kind, s.Row, s.Col = PedestrianKind, position.X, position.Y
+		s.Source = slices.IndexFunc(a.WaitingAreas, func(wa *WaitingArea) bool {
+			return wa.rel_grid.Facing() == agent.Facing()
+		})
+		s.Velocity, s.Repr, s.Crossing = agent.vel, agent.repr, agent.crossing
+		s.ArrivedAt, s.StartedAt, s.CaughtOnRed = agent.arrived_at, agent.started_at, agent.caught_on_red
+	case *Vehicle:
+		position := agent.driver_pos.Position(utils.Still())
+		s.Kind, s.Row, s.Col = VehicleKind, position.X, position.Y
+		s.Source = slices.IndexFunc(a.VehicleLanes, func(vl *VehicleLane) bool {
+			return vl.relGrid.WithCenter(position).IsInbounds(utils.Still())
+		})
+		s.Velocity, s.Repr, s.Crossing = agent.vel, agent.repr, agent.crossing
+		s.Turning, s.PlacedAt, s.Violated = agent.turning, agent.placedAt, agent.violated
+	default:
+		panic(fmt.Sprintf("cannot snapshot agent of type %T", agent))
+	}
+	return s
+}
+
+// checkSnapshot tells whether a snapshot can be restored into the automata.
+func (a *Automata) checkSnapshot(s *Snapshot) error {
+	if s.Version != SnapshotVersion {
+		return fmt.Errorf("snapshot version %d, expected %d", s.Version, SnapshotVersion)
+	}
+	if s.Seed != a.streams.Seed() {
+		return fmt.Errorf("snapshot taken from seed %d, not %d", s.Seed, a.streams.Seed())
+	}
+	if s.Rows != a.Grid.Rows() || s.Cols != a.Grid.Cols() {
+		return fmt.Errorf("snapshot of a %dx%d grid, not %dx%d", s.Rows, s.Cols, a.Grid.Rows(), a.Grid.Cols())
+	}
+	if len(s.WaitingAreas) != len(a.WaitingAreas) || len(s.VehicleLanes) != len(a.VehicleLanes) {
+		return fmt.Errorf("snapshot with %d waiting areas and %d vehicle lanes, not %d and %d",
+			len(s.WaitingAreas), len(s.VehicleLanes), len(a.WaitingAreas), len(a.VehicleLanes))
+	}
+	sources := map[string]int{PedestrianKind: len(a.WaitingAreas), VehicleKind: len(a.VehicleLanes)}
+	ids := make(map[int]bool, len(s.Agents))
+	for _, agent := range s.Agents {
+		if ids[agent.ID] || agent.ID >= s.NextAgentID {
+			return fmt.Errorf("agent %d: duplicate or not below the next agent ID %d", agent.ID, s.NextAgentID)
+		}
+		ids[agent.ID] = true
+		count, ok := sources[agent.Kind]
+		if !ok {
+			return fmt.Errorf("agent %d: unknown kind %q", agent.ID, agent.Kind)
+		}
+		if agent.Source < 0 || agent.Source >= count {
+			return fmt.Errorf("agent %d: no %s source %d", agent.ID, agent.Kind, agent.Source)
+		}
+	}
+	return nil
+}
+
+// Restore puts the automata in the state of a snapshot taken from one of the
+// same configuration and seed. If an agent cannot be placed, the error says
+// which one and the automata is left half restored.
+func (a *Automata) Restore(s *Snapshot) error {
+	if err := a.checkSnapshot(s); err != nil {
+		return err
+	}
+	if err := a.streams.Restore(s.Generators); err != nil {
+		return err
+	}
+
+	a.Epoch, a.Conflicts = s.Epoch, s.Conflicts
+	light := a.PedestrianStopLight
+	light.state, light.timeToChange = Red, s.StopLight.TimeToChange
+	if s.StopLight.Green {
+		light.state = Green
+	}
+	for i, wa := range a.WaitingAreas {
+		wa.waiting_pedestrians = s.WaitingAreas[i].Waiting
+		wa.arrived_at = slices.Clone(s.WaitingAreas[i].ArrivedAt)
+	}
+	for i, vl := range a.VehicleLanes {
+		vl.waitingVehicles = s.VehicleLanes[i].Waiting
+	}
+	a.Metrics.restore(s.Metrics)
+
+	a.Grid.Reset()
+	a.Registry.reset(s.NextAgentID)
+	for _, agent := range s.Agents {
+		if err := a.restoreAgent(agent); err != nil {
+			return fmt.Errorf("agent %d: %w", agent.ID, err)
+		}
+	}
+	return nil
+}
+
+func (a *Automata) restoreAgent(s AgentSnapshot) error {
+	position := utils.Point{X: s.Row, Y: s.Col}
+	if s.Kind == PedestrianKind {
+		wa := a.WaitingAreas[s.Source]
+		relGrid := wa.rel_grid.WithCenter(position)
+		if !relGrid.IsInbounds(utils.Still()) || relGrid.IsFill(utils.Still()) {
+			return fmt.Errorf("cell (%d, %d) is outside the walking zone or taken", s.Row, s.Col)
+		}
+		p := &Pedestrian{
+			desired_displacement: utils.Still(),
+			rel_grid:             relGrid,
+			crossing:             s.Crossing,
+			vel:                  s.Velocity,
+			repr:                 s.Repr,
+			generator:            wa.attributes,
+			metrics:              a.Metrics,
+			registry:             a.Registry,
+			arrived_at:           s.ArrivedAt,
+			started_at:           s.StartedAt,
+			caught_on_red:        s.CaughtOnRed,
+		}
+		relGrid.Fill(utils.Still(), p)
+		a.Registry.add(p, s.ID)
+		return nil
+	}
+
+	vl := a.VehicleLanes[s.Source]
+	width, length := a.Config.VehicleProt.Cols(), a.Config.VehicleProt.Rows()
+	origin := vl.relGrid.WithCenter(position).NewDisplaced(utils.Backward(length - 1))
+	for i := 0; i < width; i++ {
+		for j := 0; j < length; j++ {
+			cell := utils.Right(i).Add(utils.Forward(j))
+			if !origin.IsInbounds(cell) || origin.IsFill(cell) {
+				return fmt.Errorf("vehicle at (%d, %d) is outside its lane or overlaps another agent", s.Row, s.Col)
+			}
+		}
+	}
+	v := &Vehicle{
+		repr:             s.Repr,
+		vel:              s.Velocity,
+		crossing:         s.Crossing,
+		desired_movement: utils.Still(),
+		width:            width,
+		length:           length,
+		turning:          s.Turning,
+		generator:        vl.attributes,
+		metrics:          a.Metrics,
+		registry:         a.Registry,
+		placedAt:         s.PlacedAt,
+		violated:         s.Violated,
+	}
+	v.buildGrids(origin)
+	a.Registry.add(v, s.ID)
+	return nil
+}
+
+func (s *Snapshot) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// ReadSnapshot reads a snapshot written by Write, refusing other versions.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	s := &Snapshot{}
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, err
+	}
+	if s.Version != SnapshotVersion {
+		return nil, fmt.Errorf("snapshot version %d, this build reads version %d", s.Version, SnapshotVersion)
+	}
+	return s, nil
+}
+
+// AgentChange is an agent found in both snapshots of a diff.
+type AgentChange struct {
+	Before AgentSnapshot `json:"before"`
+	After  AgentSnapshot `json:"after"`
+}
+
+// Fields describes what changed besides the position.
+func (c AgentChange) Fields() []string {
+	var fields []string
+	describe := func(name string, before, after any) {
+		if before != after {
+			fields = append(fields, fmt.Sprintf("%s %v -> %v", name, before, after))
+		}
+	}
+	b, a := c.Before, c.After
+	describe("velocity", b.Velocity, a.Velocity)
+	describe("repr", b.Repr, a.Repr)
+	describe("crossing", b.Crossing, a.Crossing)
+	describe("started at", b.StartedAt, a.StartedAt)
+	describe("caught on red", b.CaughtOnRed, a.CaughtOnRed)
+	describe("violated", b.Violated, a.Violated)
+	return fields
+}
+
+// SnapshotDiff lists the agents that were added, removed, moved or otherwise
+// changed from one snapshot to another, by ID. It leaves out the queues, the
+// stop light and the metrics.
+type SnapshotDiff struct {
+	From    int             `json:"from_epoch"`
+	To      int             `json:"to_epoch"`
+	Added   []AgentSnapshot `json:"added"`
+	Removed []AgentSnapshot `json:"removed"`
+	Moved   []AgentChange   `json:"moved"`
+	Changed []AgentChange   `json:"changed"`
+}
+
+// Diff compares the agents of the snapshot with those of a later one.
+func (s *Snapshot) Diff(to *Snapshot) *SnapshotDiff {
+	d := &SnapshotDiff{From: s.Epoch, To: to.Epoch}
+	before := make(map[int]AgentSnapshot, len(s.Agents))
+	for _, agent := range s.Agents {
+		before[agent.ID] = agent
+	}
+	for _, after := range to.Agents {
+		b, ok := before[after.ID]
+		if !ok {
+			d.Added = append(d.Added, after)
+			continue
+		}
+		delete(before, after.ID)
+		change := AgentChange{b, after}
+		if b.Row != after.Row || b.Col != after.Col {
+			d.Moved = append(d.Moved, change)
+		} else if b != after {
+			d.Changed = append(d.Changed, change)
+		}
+	}
+	for _, agent := range before {
+		d.Removed = append(d.Removed, agent)
+	}
+
+	byID := func(a, b AgentSnapshot) int { return a.ID - b.ID }
+	byIDBefore := func(a, b AgentChange) int { return a.Before.ID - b.Before.ID }
+	slices.SortFunc(d.Added, byID)
+	slices.SortFunc(d.Removed, byID)
+	slices.SortFunc(d.Moved, byIDBefore)
+	slices.SortFunc(d.Changed, byIDBefore)
+	return d
+}
+
+func (d *SnapshotDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Moved) == 0 && len(d.Changed) == 0
+}
+
+// String lists the differences one agent per line: + added, - removed,
+// > moved and ~ changed in place.
+func (d *SnapshotDiff) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Epoch %d to %d: %d added, %d removed, %d moved, %d changed\n",
+		d.From, d.To, len(d.Added), len(d.Removed), len(d.Moved), len(d.Changed))
+	for _, agent := range d.Added {
+		fmt.Fprintf(&b, "+ %s %d at (%d, %d)\n", agent.Kind, agent.ID, agent.Row, agent.Col)
+	}
+	for _, agent := range d.Removed {
+		fmt.Fprintf(&b, "- %s %d at (%d, %d)\n", agent.Kind, agent.ID, agent.Row, agent.Col)
+	}
+	for _, c := range d.Moved {
+		fmt.Fprintf(&b, "> %s %d (%d, %d) -> (%d, %d)", c.After.Kind, c.After.ID, c.Before.Row, c.Before.Col, c.After.Row, c.After.Col)
+		if fields := c.Fields(); len(fields) > 0 {
+			fmt.Fprintf(&b, ": %s", strings.Join(fields, ", "))
+		}
+		b.WriteString("\n")
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(&b, "~ %s %d at (%d, %d): %s\n", c.After.Kind, c.After.ID, c.After.Row, c.After.Col, strings.Join(c.Fields(), ", "))
+	}
+	return b.String()
+}
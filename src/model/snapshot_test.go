@@ -0,0 +1,96 @@
+package model
+
+import (
+	"bytes"
+	"go_automata/src/generator"
+	"go_automata/src/utils"
+	"testing"
+)
+
+const (
+	snapshotSeed  = 9000000
+	snapshotEpoch = 400
+	finalEpoch    = 1000
+)
+
+func newTestAutomata(t *testing.T, scheme string) *Automata {
+	t.Helper()
+	params := utils.DefaultConfigParams()
+	params.Dynamics.UpdateScheme = scheme
+	factory, err := generator.Lookup(generator.DefaultName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	automata, err := NewAutomata(params.Build(), generator.NewStreams(factory, snapshotSeed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return automata
+}
+
+func encode(t *testing.T, s *Snapshot) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := s.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// A run restored from a snapshot and advanced must end exactly where the run
+// that was never interrupted does.
+func TestRestoredRunMatchesUninterruptedRun(t *testing.T) {
+	for _, scheme := range utils.UpdateSchemes {
+		t.Run(scheme, func(t *testing.T) {
+			original := newTestAutomata(t, scheme)
+			original.RecordSnapshotAt(snapshotEpoch, finalEpoch)
+			original.AdvanceTo(finalEpoch)
+			if original.Metrics.PedestriansCrossed == 0 || original.Metrics.VehiclesPassed == 0 {
+				t.Fatal("the run moved no agents, so there is nothing to compare")
+			}
+			saved, ok := original.RecordedSnapshot(snapshotEpoch)
+			if !ok {
+				t.Fatalf("no snapshot at epoch %d", snapshotEpoch)
+			}
+			want, ok := original.RecordedSnapshot(finalEpoch)
+			if !ok {
+				t.Fatalf("no snapshot at the final epoch %d", finalEpoch)
+			}
+
+			// The snapshot goes through its file format, as it does between
+			// the run and replay commands.
+			read, err := ReadSnapshot(bytes.NewReader(encode(t, saved)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			restored := newTestAutomata(t, scheme)
+			if err := restored.Restore(read); err != nil {
+				t.Fatal(err)
+			}
+			if restored.Epoch != snapshotEpoch {
+				t.Fatalf("restored at epoch %d, want %d", restored.Epoch, snapshotEpoch)
+			}
+			// Step through the epochs the way the interactive commands do.
+			restored.RecordSnapshotAt(finalEpoch)
+			for restored.Epoch < finalEpoch {
+				restored.Update()
+			}
+			restored.RecordState()
+			got, ok := restored.RecordedSnapshot(finalEpoch)
+			if !ok {
+				t.Fatalf("the restored run took no snapshot at the final epoch %d", finalEpoch)
+			}
+
+			if diff := want.Diff(got); !diff.Empty() {
+				t.Errorf("restored run differs from the uninterrupted one:\n%s", diff)
+			}
+			if !bytes.Equal(encode(t, want), encode(t, got)) {
+				t.Error("restored run ends in a different snapshot than the uninterrupted one")
+			}
+			if restored.Conflicts != original.Conflicts || restored.Metrics.PedestriansCrossed != original.Metrics.PedestriansCrossed {
+				t.Errorf("restored run has %d conflicts and %d crossings, want %d and %d",
+					restored.Conflicts, restored.Metrics.PedestriansCrossed, original.Conflicts, original.Metrics.PedestriansCrossed)
+			}
+		})
+	}
+}
@@ -16,15 +16,15 @@ type StopLight struct {
 	state          StopLightState
 }
 
-func NewStopLight(cycle, greenLightTime int, initialState StopLightState) *StopLight {
-	if greenLightTime >= cycle {
-		panic("green light time must be less than cycle")
+func NewStopLight(cycle, greenLightTime int, initialState StopLightState) (*StopLight, error) {
+	if greenLightTime <= 0 || greenLightTime >= cycle {
+		return nil, fmt.Errorf("green light time must be between 1 and the cycle minus one (%d), got %d", cycle-1, greenLightTime)
 	}
 	timeToChange := greenLightTime
 	if initialState == Red {
 		timeToChange = cycle - greenLightTime
 	}
-	return &StopLight{cycle, greenLightTime, timeToChange, initialState}
+	return &StopLight{cycle, greenLightTime, timeToChange, initialState}, nil
 }
 
 func (sl *StopLight) Update() {
@@ -40,6 +40,12 @@ func (sl *StopLight) Update() {
 	}
 }
 
+// Switch makes the light change on its next update, cutting the current
+// phase short. The next phase lasts as long as usual.
+func (sl *StopLight) Switch() {
+	sl.timeToChange = 1
+}
+
 func (sl *StopLight) IsGreen() bool {
 	return sl.state == Green
 }
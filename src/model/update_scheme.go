@@ -0,0 +1,114 @@
+package model
+
+import (
+	"fmt"
+	"go_automata/src/utils"
+	"slices"
+)
+
+// UpdateScheme takes the agents of an automata through an epoch, once the
+// stop light and the waiting areas are updated: every agent thinks, deciding
+// where to go, and then moves. Who goes first decides who gets a cell that
+// several agents want.
+type UpdateScheme interface {
+	Update(a *Automata)
+}
+
+// NewUpdateScheme returns the scheme of the given name, one of
+// utils.UpdateSchemes.
+func NewUpdateScheme(name string) (UpdateScheme, error) {
+	switch name {
+	case "", utils.RandomSequentialUpdate:
+		return randomSequentialUpdate{}, nil
+	case utils.SynchronousUpdate:
+		return synchronousUpdate{}, nil
+	case utils.VehiclesFirstUpdate:
+		return byTypeUpdate{vehiclesFirst: true}, nil
+	case utils.PedestriansFirstUpdate:
+		return byTypeUpdate{vehiclesFirst: false}, nil
+	}
+	return nil, fmt.Errorf("unknown update scheme %q, expected one of %v", name, utils.UpdateSchemes)
+}
+
+// randomSequentialUpdate has every agent think and then move, one after the
+// other in a new random order each time, so that an agent sees the moves of
+// those that went before it.
+type randomSequentialUpdate struct{}
+
+func (randomSequentialUpdate) Update(a *Automata) {
+	a.Registry.Apply(a.think)
+	a.Registry.Apply(a.move)
+}
+
+// byTypeUpdate moves all the vehicles before all the pedestrians, or the
+// other way around, in a random order within each type.
+type byTypeUpdate struct {
+	vehiclesFirst bool
+}
+
+func (s byTypeUpdate) Update(a *Automata) {
+	a.Registry.Apply(a.think)
+	order := a.Registry.Shuffle()
+	for _, vehicles := range []bool{s.vehiclesFirst, !s.vehiclesFirst} {
+		for _, entity := range order {
+			if entity.IsVehicle() == vehicles {
+				a.move(entity)
+			}
+		}
+	}
+}
+
+// planner is an agent whose move can be settled on the grid as it is and
+// carried out later.
+type planner interface {
+	// plan settles the move and tells whether it is a conflict.
+	plan(crosswalkZone *utils.Rectangle) bool
+	// claims returns the cells the planned move takes.
+	claims() []utils.Point
+	// yield gives up the planned move to the agent that claimed one of its
+	// cells first, telling whether that is a conflict.
+	yield(crosswalkZone *utils.Rectangle, winner planner) bool
+	// apply carries out the planned move.
+	apply()
+}
+
+// synchronousUpdate has every agent think and plan its move on the grid as
+// the epoch found it, and then carries out all the moves at once. A cell
+// claimed by several agents goes to the first of them in a random order, and
+// the others stay in place; a vehicle giving way to a pedestrian this way is
+// the conflict that finding it ahead is in the sequential schemes. The cells
+// planned are free at the start of the epoch, so no agent steps into a cell
+// another one is leaving.
+type synchronousUpdate struct{}
+
+func (synchronousUpdate) Update(a *Automata) {
+	a.Registry.Apply(a.think)
+
+	order := a.Registry.Shuffle()
+	planners := make([]planner, len(order))
+	for i, entity := range order {
+		planners[i] = entity.(planner)
+		if planners[i].plan(a.CrosswalkZone) {
+			a.conflict()
+		}
+	}
+
+	claimed := make(map[utils.Point]planner)
+	for _, p := range planners {
+		cells := p.claims()
+		i := slices.IndexFunc(cells, func(cell utils.Point) bool { return claimed[cell] != nil })
+		if i >= 0 {
+			if p.yield(a.CrosswalkZone, claimed[cells[i]]) {
+				a.conflict()
+			}
+			continue
+		}
+		for _, cell := range cells {
+			claimed[cell] = p
+		}
+	}
+
+	for _, p := range planners {
+		p.apply()
+	}
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"go_automata/src/generator"
+	"go_automata/src/grid"
+	"go_automata/src/utils"
+	"testing"
+)
+
+// Two pedestrians about to cross from both ends of a corridor claim the cell
+// between them. Only the one that gets it starts crossing; the other keeps
+// waiting, and its start is not recorded.
+func TestSynchronousYieldedPedestrianDoesNotStart(t *testing.T) {
+	for seed := uint64(9000000); seed < 9000020; seed++ {
+		g := grid.NewGrid[RoadEntity](1, 5)
+		zone := utils.NewRectangle(1, 5)
+		light, err := NewStopLight(10, 5, Green)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := &Automata{
+			Grid:                g,
+			CrosswalkZone:       zone,
+			PedestrianStopLight: light,
+			Metrics:             NewMetrics(10),
+			Registry:            NewRegistry(generator.NewXoshiro256(seed)),
+		}
+		attributes := generator.NewXoshiro256(seed)
+		place := func(col int, facing utils.Direction) *Pedestrian {
+			p := NewPedestrian(grid.NewRelativeGrid(utils.Point{X: 0, Y: col}, zone, facing, g), 2, "p", attributes)
+			p.metrics = a.Metrics
+			p.registry = a.Registry
+			g.Fill(0, col, p)
+			a.Registry.Add(p)
+			return p
+		}
+		east, west := place(1, utils.East), place(3, utils.West)
+
+		synchronousUpdate{}.Update(a)
+
+		if got := a.Metrics.PedestriansStarted; got != 1 {
+			t.Errorf("seed %d: %d pedestrians started, want the one that moved", seed, got)
+		}
+		moved := 0
+		for _, p := range []*Pedestrian{east, west} {
+			if g.IsFill(0, 2) && g.GetValue(0, 2) == RoadEntity(p) {
+				moved++
+				if !p.IsCrossing() {
+					t.Errorf("seed %d: the pedestrian that moved is not crossing", seed)
+				}
+			} else if p.IsCrossing() {
+				t.Errorf("seed %d: the pedestrian that yielded is crossing", seed)
+			}
+		}
+		if moved != 1 {
+			t.Errorf("seed %d: %d pedestrians took the middle cell, want 1", seed, moved)
+		}
+	}
+}
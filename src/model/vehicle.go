@@ -13,16 +13,25 @@ type Vehicle struct {
 	desired_movement *utils.RelativePosition
 	width            int
 	length           int
-	relative_origins []*grid.RelativeGrid
-	driver_pos       *grid.RelativeGrid
+	relative_origins []*grid.RelativeGrid[RoadEntity]
+	driver_pos       *grid.RelativeGrid[RoadEntity]
 	turning          bool
 	generator        generator.Generator
+	metrics          *Metrics
+	registry         *Registry
+	placedAt         int
+	violated         bool
+	stopped          bool
+	leaving          bool
 }
 
-func NewVehicle(origin *grid.RelativeGrid, prototype *utils.Rectangle, turning bool, generator generator.Generator) *Vehicle {
+func NewVehicle(origin *grid.RelativeGrid[RoadEntity], prototype *utils.Rectangle, turning bool, generator generator.Generator) *Vehicle {
 	repr_values := []string{"🟥", "🟧", "🟨", "🟩", "🟦", "🟪", "🟫"}
 	i := generator.RandInt(0, len(repr_values))
+	return newVehicle(origin, prototype, turning, repr_values[i], generator)
+}
 
+func newVehicle(origin *grid.RelativeGrid[RoadEntity], prototype *utils.Rectangle, turning bool, repr string, generator generator.Generator) *Vehicle {
 	v := &Vehicle{
 		vel:              10,
 		crossing:         false,
@@ -30,15 +39,15 @@ func NewVehicle(origin *grid.RelativeGrid, prototype *utils.Rectangle, turning b
 		width:            prototype.Cols(),
 		length:           prototype.Rows(),
 		turning:          turning,
-		repr:             repr_values[i],
+		repr:             repr,
 		generator:        generator,
 	}
 	v.buildGrids(origin)
 	return v
 }
 
-func (v *Vehicle) buildGrids(origin *grid.RelativeGrid) {
-	v.relative_origins = make([]*grid.RelativeGrid, 0)
+func (v *Vehicle) buildGrids(origin *grid.RelativeGrid[RoadEntity]) {
+	v.relative_origins = make([]*grid.RelativeGrid[RoadEntity], 0)
 	for i := 0; i < v.width; i++ {
 		for j := 0; j < v.length; j++ {
 			origin_ij := origin.NewDisplaced(utils.Right(i).Add(utils.Forward(j)))
@@ -64,6 +73,10 @@ func (v *Vehicle) IsVehicle() bool {
 	return true
 }
 
+func (v *Vehicle) AsPedestrian() *Pedestrian {
+	return nil
+}
+
 func (v *Vehicle) IsCrossing() bool {
 	return v.crossing
 }
@@ -91,8 +104,7 @@ func (v *Vehicle) IsEntityAhead() bool {
 func (v *Vehicle) IsPedestrianAhead() bool {
 	for i := 0; i < v.width; i++ {
 		entity := v.driver_pos.GetNext(utils.Right(i), nil, v.vel)
-		switch entity.(type) {
-		case *Pedestrian:
+		if entity != nil && entity.AsPedestrian() != nil {
 			return true
 		}
 	}
@@ -107,7 +119,23 @@ func (v *Vehicle) Think(crosswalkZone *utils.Rectangle, pedestrianStopLight *Sto
 	}
 }
 
+func (v *Vehicle) IsIn(zone *utils.Rectangle) bool {
+	if v.driver_pos.IsIn(zone) {
+		return true
+	}
+	for _, relGridI := range v.relative_origins {
+		if relGridI.IsIn(zone) {
+			return true
+		}
+	}
+	return false
+}
+
 func (v *Vehicle) thinkStraight(crosswalkZone *utils.Rectangle, pedestrianStopLight *StopLight) {
+	if pedestrianStopLight.IsGreen() && !v.violated && v.IsIn(crosswalkZone) {
+		v.violated = true
+		v.metrics.redLightViolation()
+	}
 	if v.IsEntityAhead() || (pedestrianStopLight.IsGreen() && !v.crossing) {
 		v.desired_movement = utils.Still()
 	} else if v.crossing || pedestrianStopLight.IsRed() {
@@ -126,30 +154,94 @@ func (v *Vehicle) thinkTurning(crosswalkZone *utils.Rectangle, pedestrianStopLig
 }
 
 func (v *Vehicle) Move(crosswalkZone *utils.Rectangle) bool {
+	conflict := v.plan(crosswalkZone)
+	v.apply()
+	return conflict
+}
+
+// plan settles the move decided by Think on the grid as it is, telling
+// whether the vehicle is held back by a pedestrian it would run into on the
+// crosswalk.
+func (v *Vehicle) plan(crosswalkZone *utils.Rectangle) bool {
+	v.stopped, v.leaving = false, false
 	if v.desired_movement.IsStill() {
+		v.stopped = true
 		return false
 	}
 
 	if v.IsPedestrianAhead() {
-		for _, relGridI := range v.relative_origins {
-			if relGridI.NewDisplaced(v.desired_movement).IsIn(crosswalkZone) {
-				return true
+		v.stopped = true
+		return v.entersZone(crosswalkZone)
+	}
+
+	v.leaving = !v.driver_pos.IsInbounds(v.desired_movement)
+	return false
+}
+
+// entersZone tells whether the desired movement takes a part of the vehicle
+// into zone.
+func (v *Vehicle) entersZone(zone *utils.Rectangle) bool {
+	for _, relGridI := range v.relative_origins {
+		if relGridI.NewDisplaced(v.desired_movement).IsIn(zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// claims returns the cells the planned move drives through, the ones that
+// IsPedestrianAhead looks at, and those it ends up taking.
+func (v *Vehicle) claims() []utils.Point {
+	if v.stopped {
+		return nil
+	}
+	var cells []utils.Point
+	for i := 0; i < v.width; i++ {
+		for j := 1; j <= v.vel; j++ {
+			step := utils.Right(i).Add(utils.Forward(j))
+			if v.driver_pos.IsInbounds(step) {
+				cells = append(cells, v.driver_pos.Position(step))
 			}
 		}
-		return false
+	}
+	if v.leaving {
+		return cells
+	}
+	cells = append(cells, v.driver_pos.Position(v.desired_movement))
+	for _, relGridI := range v.relative_origins {
+		cells = append(cells, relGridI.Position(v.desired_movement))
+	}
+	return cells
+}
+
+// yield gives up the planned move and stays in place. Giving way to a
+// pedestrian is a conflict when the move would have entered the crosswalk.
+func (v *Vehicle) yield(crosswalkZone *utils.Rectangle, winner planner) bool {
+	v.stopped = true
+	_, pedestrian := winner.(*Pedestrian)
+	return pedestrian && v.entersZone(crosswalkZone)
+}
+
+// apply carries out the planned move.
+func (v *Vehicle) apply() {
+	if v.stopped {
+		return
 	}
 
-	if !v.driver_pos.IsInbounds(v.desired_movement) {
+	if v.leaving {
 		v.Remove()
-		return false
+		v.metrics.vehiclePassed()
+		return
 	}
 
-	v.crossing = true
+	if !v.crossing {
+		v.crossing = true
+		v.metrics.vehicleStarted(v.placedAt)
+	}
 	v.driver_pos.Move(v.desired_movement)
 	for _, relGridI := range v.relative_origins {
 		relGridI.Move(v.desired_movement)
 	}
-	return false
 }
 
 func (v *Vehicle) Remove() {
@@ -157,6 +249,7 @@ func (v *Vehicle) Remove() {
 	for _, relGridI := range v.relative_origins {
 		relGridI.Clear(utils.Still())
 	}
+	v.registry.Remove(v)
 }
 
 func (v *Vehicle) String() string {
@@ -169,10 +262,10 @@ func (v *Vehicle) Repr() string {
 
 type VehiclePart struct {
 	parent         *Vehicle
-	relativeOrigin *grid.RelativeGrid
+	relativeOrigin *grid.RelativeGrid[RoadEntity]
 }
 
-func NewVehiclePart(parent *Vehicle, relativeOrigin *grid.RelativeGrid) *VehiclePart {
+func NewVehiclePart(parent *Vehicle, relativeOrigin *grid.RelativeGrid[RoadEntity]) *VehiclePart {
 	return &VehiclePart{
 		parent:         parent,
 		relativeOrigin: relativeOrigin,
@@ -187,6 +280,10 @@ func (vp *VehiclePart) IsVehicle() bool {
 	return true
 }
 
+func (vp *VehiclePart) AsPedestrian() *Pedestrian {
+	return nil
+}
+
 func (vp *VehiclePart) IsCrossing() bool {
 	return vp.parent.IsCrossing()
 }
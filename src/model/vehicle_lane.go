@@ -8,18 +8,21 @@ import (
 
 type VehicleLane struct {
 	config          *utils.Config
-	relGrid         *grid.RelativeGrid
+	relGrid         *grid.RelativeGrid[RoadEntity]
 	waitingVehicles int
 	turning         bool
-	generator       generator.Generator
+	arrivals        generator.Generator
+	attributes      generator.Generator
+	metrics         *Metrics
+	registry        *Registry
 }
 
-func NewVehicleLane(config *utils.Config, relGrid *grid.RelativeGrid, turning bool, generator generator.Generator) *VehicleLane {
-	return &VehicleLane{config, relGrid, 0, turning, generator}
+func NewVehicleLane(config *utils.Config, relGrid *grid.RelativeGrid[RoadEntity], turning bool, arrivals, attributes generator.Generator, metrics *Metrics, registry *Registry) *VehicleLane {
+	return &VehicleLane{config, relGrid, 0, turning, arrivals, attributes, metrics, registry}
 }
 
 func (vl *VehicleLane) generateVehicle() {
-	newVehicles := vl.generator.Poi(vl.config.VehicleArrivalRate)
+	newVehicles := vl.arrivals.Poi(vl.config.VehicleArrivalRate)
 	vl.waitingVehicles += newVehicles
 }
 
@@ -33,18 +36,27 @@ func (vl *VehicleLane) canPlaceVehicle() bool {
 	return true
 }
 
+func (vl *VehicleLane) origin() *grid.RelativeGrid[RoadEntity] {
+	offset := (vl.relGrid.Cols() - vl.config.VehicleProt.Cols()) / 2
+	return vl.relGrid.NewDisplaced(utils.Right(offset))
+}
+
 func (vl *VehicleLane) placeVehicle() {
 	if vl.waitingVehicles == 0 || !vl.canPlaceVehicle() {
 		return
 	}
 
-	offset := (vl.relGrid.Cols() - vl.config.VehicleProt.Cols()) / 2
-
-	vehicleGrid := vl.relGrid.NewDisplaced(utils.Right(offset))
-	NewVehicle(vehicleGrid, vl.config.VehicleProt, vl.turning, vl.generator)
+	vl.register(NewVehicle(vl.origin(), vl.config.VehicleProt, vl.turning, vl.attributes))
 	vl.waitingVehicles--
 }
 
+func (vl *VehicleLane) register(vehicle *Vehicle) {
+	vehicle.metrics = vl.metrics
+	vehicle.placedAt = vl.metrics.Epoch()
+	vehicle.registry = vl.registry
+	vl.registry.Add(vehicle)
+}
+
 func (vl *VehicleLane) Update() {
 	vl.generateVehicle()
 	vl.placeVehicle()
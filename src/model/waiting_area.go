@@ -7,23 +7,36 @@ import (
 )
 
 type WaitingArea struct {
-	rel_grid            *grid.RelativeGrid
+	rel_grid            *grid.RelativeGrid[RoadEntity]
 	waiting_pedestrians int
 	arrival_rate        float64
 	max_size            int
-	generator           generator.Generator
+	arrivals            generator.Generator
+	pedestrians         generator.Generator
+	attributes          generator.Generator
+	metrics             *Metrics
+	registry            *Registry
+	arrived_at          []int
 }
 
-func NewWaitingArea(arrival_rate float64, rel_grid *grid.RelativeGrid, max_size int, generator generator.Generator) *WaitingArea {
-	return &WaitingArea{rel_grid, 0, arrival_rate, max_size, generator}
+// NewWaitingArea returns a waiting area whose pedestrians arrive as drawn
+// from arrivals and are placed as drawn from pedestrians. The pedestrians
+// draw their own attributes and moves from attributes, so that they do not
+// change where the next ones are placed.
+func NewWaitingArea(arrival_rate float64, rel_grid *grid.RelativeGrid[RoadEntity], max_size int, arrivals, pedestrians, attributes generator.Generator, metrics *Metrics, registry *Registry) *WaitingArea {
+	return &WaitingArea{rel_grid, 0, arrival_rate, max_size, arrivals, pedestrians, attributes, metrics, registry, nil}
 }
 
+// generatePedestrians draws the arrivals of the epoch, even while the area is
+// full, and drops those that do not fit.
 func (wa *WaitingArea) generatePedestrians() {
-	if wa.waiting_pedestrians == wa.max_size {
-		return
-	}
-	new_pedestrians := min(wa.max_size-wa.waiting_pedestrians, wa.generator.Poi(wa.arrival_rate))
+	arrived := wa.arrivals.Poi(wa.arrival_rate)
+	new_pedestrians := min(wa.max_size-wa.waiting_pedestrians, arrived)
 	wa.waiting_pedestrians += new_pedestrians
+	wa.metrics.pedestriansArrived(arrived, arrived-new_pedestrians)
+	for i := 0; i < new_pedestrians; i++ {
+		wa.arrived_at = append(wa.arrived_at, wa.metrics.Epoch())
+	}
 }
 
 func (wa *WaitingArea) canPlacePedestrian() bool {
@@ -38,13 +51,19 @@ func (wa *WaitingArea) canPlacePedestrian() bool {
 func (wa *WaitingArea) placePedestrian() {
 	rows := wa.rel_grid.Rows()
 
-	possible_pos := wa.generator.RandInt(0, rows)
+	possible_pos := wa.pedestrians.RandInt(0, rows)
 	for wa.rel_grid.IsFill(utils.Right(possible_pos)) {
 		possible_pos = (possible_pos + 1) % rows
 	}
 
 	pedestrian_grid := wa.rel_grid.NewDisplaced(utils.Right(possible_pos))
-	wa.rel_grid.Fill(utils.Right(possible_pos), NewPedestrian(pedestrian_grid, 0, "", wa.generator))
+	pedestrian := NewPedestrian(pedestrian_grid, 0, "", wa.attributes)
+	pedestrian.metrics = wa.metrics
+	pedestrian.registry = wa.registry
+	pedestrian.arrived_at = wa.arrived_at[0]
+	wa.arrived_at = wa.arrived_at[1:]
+	wa.rel_grid.Fill(utils.Right(possible_pos), pedestrian)
+	wa.registry.Add(pedestrian)
 	wa.waiting_pedestrians--
 }
 
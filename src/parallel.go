@@ -1,22 +1,75 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"go_automata/src/generator"
 	"go_automata/src/model"
+	"go_automata/src/stats"
 	"go_automata/src/utils"
+	"math"
 	"time"
 )
 
 type Result struct {
+	Index                 uint64
+	Runs                  int
 	PedestrianArrivalRate float64
 	VehicleArrivalRate    float64
 	Conflicts             float64
+	ComparedConflicts     float64
+	Difference            float64
+	DifferenceStdErr      float64
+	ComparedReplications  []int
+	// Metrics holds the mean of every metric, Replications its value on
+	// each replication and Summaries the distribution of the metrics listed
+	// in the outputs' summarize setting, in that order.
+	Metrics      []float64
+	Replications [][]float64
+	Summaries    []*Summary
+	Seeds        []uint64
+	StartedAt    time.Time
+	Duration     time.Duration
+	// Err tells why the configuration was abandoned, in which case the
+	// result holds nothing else.
+	Err error
+}
+
+// Metric is a measure of performance of a run, reported for every
+// configuration as the mean over its replications.
+type Metric struct {
+	Name  string
+	Value func(a *model.Automata) float64
+}
+
+var metrics = []Metric{
+	{"conflicts", func(a *model.Automata) float64 { return float64(a.Conflicts) }},
+	{"pedestrian_delay", func(a *model.Automata) float64 { return a.Metrics.MeanPedestrianDelay() }},
+	{"crossing_time", func(a *model.Automata) float64 { return a.Metrics.MeanCrossingTime() }},
+	{"vehicle_delay", func(a *model.Automata) float64 { return a.Metrics.MeanVehicleDelay() }},
+	{"vehicle_queue", func(a *model.Automata) float64 { return a.Metrics.MeanVehicleQueue() }},
+	{"max_vehicle_queue", func(a *model.Automata) float64 { return float64(a.Metrics.MaxVehicleQueue) }},
+	{"pedestrian_queue", func(a *model.Automata) float64 { return a.Metrics.MeanPedestrianQueue() }},
+	{"red_light_violations", func(a *model.Automata) float64 { return float64(a.Metrics.RedLightViolations) }},
+	{"throughput_per_cycle", func(a *model.Automata) float64 { return a.Metrics.MeanThroughput() }},
+	{"dropped_pedestrians", func(a *model.Automata) float64 { return float64(a.Metrics.PedestriansDropped) }},
+}
+
+func metricIndex(name string) int {
+	for k, metric := range metrics {
+		if metric.Name == name {
+			return k
+		}
+	}
+	return -1
 }
 
 type Input struct {
-	i      uint64
-	config *utils.Config
+	i        uint64
+	config   *utils.Config
+	compared *utils.Config
+	done     map[uint64]*CheckpointEntry
 }
 
 func NewResult(pedestrianArrivalRate, vehicleArrivalRate float64, conflicts float64) *Result {
@@ -27,31 +80,195 @@ func NewResult(pedestrianArrivalRate, vehicleArrivalRate float64, conflicts floa
 	}
 }
 
-func run(cfg *ScenarioConfig, inputCh chan Input, resultsCh chan *Result) {
+// Replication seeds start at seedBase, and every configuration has
+// seedsPerConfiguration of them before they overlap with the next one's.
+const (
+	seedBase              = 9000000
+	seedsPerConfiguration = 100
+)
+
+// replicationSeed returns the seed of the j-th replication of the i-th
+// configuration. With antithetic variates, replications come in pairs that
+// share a seed, the second one mirroring every uniform of the first.
+func replicationSeed(cfg *ScenarioConfig, i, j uint64) (uint64, bool) {
+	if cfg.Replications.Antithetic {
+		return seedBase + i*seedsPerConfiguration + j - j%2, j%2 == 1
+	}
+	return seedBase + i*seedsPerConfiguration + j, false
+}
+
+// needsMoreRuns tells whether a configuration whose target metric took the
+// given values needs another replication. With a target half-width, runs are
+// added until the confidence interval of the metric is narrow enough or the
+// maximum is reached, always completing antithetic pairs.
+func needsMoreRuns(cfg *ScenarioConfig, values []float64) bool {
+	runs := len(values)
+	if runs < cfg.Replications.RunsPerSimulation {
+		return true
+	}
+	if cfg.Replications.TargetHalfWidth <= 0 || runs >= cfg.Replications.MaxRunsPerSimulation {
+		return false
+	}
+	if cfg.Replications.Antithetic && runs%2 == 1 {
+		return true
+	}
+	halfWidth := stats.THalfWidth(replicationUnits(cfg, values), cfg.Outputs.ConfidenceLevel)
+	return math.IsNaN(halfWidth) || halfWidth > cfg.Replications.TargetHalfWidth
+}
+
+func simulate(ctx context.Context, cfg *ScenarioConfig, config *utils.Config, factory generator.Factory, seed uint64, antithetic bool) (*model.Automata, error) {
+	if antithetic {
+		factory = generator.AntitheticFactory(factory)
+	}
+	streams := generator.NewStreams(factory, seed)
+	automata, err := model.NewAutomata(config, streams)
+	if err != nil {
+		return nil, err
+	}
+	return automata, automata.AdvanceToContext(ctx, cfg.Replications.SimulationTime)
+}
+
+// pairedStdErr computes the standard error of the mean difference between
+// two sets of replications run with common random numbers. Antithetic pairs
+// are averaged first, since their two halves are not independent.
+func pairedStdErr(cfg *ScenarioConfig, results, compared []int) float64 {
+	differences := make([]float64, len(results))
+	for j := range results {
+		differences[j] = float64(results[j] - compared[j])
+	}
+	return stats.StdErr(replicationUnits(cfg, differences))
+}
+
+func average[T int | float64](results []T) float64 {
+	var total T
+	for _, r := range results {
+		total += r
+	}
+	return float64(total) / float64(len(results))
+}
+
+// ReplicationRecorder keeps every replication as soon as it finishes: the
+// checkpoint of a sweep run here, or the coordinator of a distributed one.
+type ReplicationRecorder interface {
+	Record(entry *CheckpointEntry) error
+}
+
+// replicate runs the j-th replication of a configuration, or takes it from
+// the checkpoint if it was already finished, and records it. The run and its
+// compared run stop early when ctx is done or they take longer than the run
+// timeout together.
+func replicate(ctx context.Context, cfg *ScenarioConfig, input Input, j uint64, factory generator.Factory, recorder ReplicationRecorder) (*CheckpointEntry, error) {
+	if entry, ok := input.done[j]; ok {
+		return entry, nil
+	}
+	if cfg.Replications.RunTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(cfg.Replications.RunTimeout*float64(time.Second)))
+		defer cancel()
+	}
+	seed, antithetic := replicationSeed(cfg, input.i, j)
+	automata, err := simulate(ctx, cfg, input.config, factory, seed, antithetic)
+	if err != nil {
+		return nil, err
+	}
+	entry := &CheckpointEntry{Config: input.i, Replication: j, Seed: seed}
+	for _, metric := range metrics {
+		entry.Values = append(entry.Values, metric.Value(automata))
+	}
+	if input.compared != nil {
+		automata, err := simulate(ctx, cfg, input.compared, factory, seed, antithetic)
+		if err != nil {
+			return nil, err
+		}
+		entry.ComparedConflicts = &automata.Conflicts
+	}
+	if err := recorder.Record(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// run simulates the configurations it receives until inputCh is closed or
+// ctx is done. A configuration that fails, such as when a replication times
+// out, is sent back with the error, and one cut short by ctx is not sent at
+// all.
+func run(ctx context.Context, cfg *ScenarioConfig, recorder ReplicationRecorder, inputCh chan Input, resultsCh chan *Result) {
+	newGenerator, err := generator.Lookup(cfg.Replications.Generator)
+	if err != nil {
+		panic(err)
+	}
+
 	for input := range inputCh {
-		i := input.i
-		config := input.config
-
-		println("Starting automata...")
-		start := time.Now()
-		results := make([]int, 0)
-		var j uint64
-		for j = 0; j < uint64(cfg.RunsPerSimulation); j++ {
-			bbs := generator.NewBlumBlumShub(9000000 + i*100 + j)
-			automata := model.NewAutomata(config, bbs)
-			automata.AdvanceTo(cfg.SimulationTime)
-			results = append(results, automata.Conflicts)
+		result, err := simulateConfiguration(ctx, cfg, input, newGenerator, recorder)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			result = &Result{Index: input.i, Err: err}
 		}
-		fmt.Println("Scenario", i, "finished in", time.Since(start))
+		resultsCh <- result
+	}
+}
+
+// simulateConfiguration runs the replications of a configuration that are
+// not done yet and summarizes all of them.
+func simulateConfiguration(ctx context.Context, cfg *ScenarioConfig, input Input, newGenerator generator.Factory, recorder ReplicationRecorder) (*Result, error) {
+	i := input.i
+	config := input.config
 
-		pedestrianArrivalRate := config.PedestrianArrivalRate
-		vehicleArrivalRate := config.VehicleArrivalRate
-		total := 0
-		for _, r := range results {
-			total += r
+	start := time.Now()
+	results := make([]int, 0)
+	compared := make([]int, 0)
+	values := make([][]float64, len(metrics))
+	target := metricIndex(cfg.Replications.TargetMetric)
+	var seed uint64
+	var seeds []uint64
+	var j uint64
+	for j = 0; needsMoreRuns(cfg, values[target]); j++ {
+		entry, err := replicate(ctx, cfg, input, j, newGenerator, recorder)
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				err = fmt.Errorf("replication %d took longer than %gs", j, cfg.Replications.RunTimeout)
+			}
+			return nil, err
 		}
-		average := float64(total) / float64(len(results))
-		fmt.Printf("Pedestrian arrival rate: %.2f, Vehicle arrival rate: %.2f, Average conflicts: %.2f\n", pedestrianArrivalRate, vehicleArrivalRate, average)
-		resultsCh <- NewResult(pedestrianArrivalRate, vehicleArrivalRate, average)
+		seed = entry.Seed
+		seeds = append(seeds, seed)
+		// Conflicts are the first metric.
+		results = append(results, int(entry.Values[0]))
+		for k := range metrics {
+			values[k] = append(values[k], entry.Values[k])
+		}
+		if input.compared != nil {
+			compared = append(compared, *entry.ComparedConflicts)
+		}
+	}
+	duration := time.Since(start)
+
+	pedestrianArrivalRate := config.PedestrianArrivalRate
+	vehicleArrivalRate := config.VehicleArrivalRate
+	result := NewResult(pedestrianArrivalRate, vehicleArrivalRate, average(results))
+	result.Index = i
+	result.Runs = int(j)
+	result.Seeds = seeds
+	result.StartedAt = start
+	result.Duration = duration
+	result.Replications = values
+	for _, v := range values {
+		result.Metrics = append(result.Metrics, average(v))
+	}
+	// The bootstrap draws from its own streams, seeded like the last
+	// replication, so it never shares random numbers with a run.
+	streams := generator.NewStreams(newGenerator, seed)
+	for _, name := range cfg.Outputs.Summarize {
+		g := streams.Get("bootstrap/" + name)
+		result.Summaries = append(result.Summaries, summarize(cfg, values[metricIndex(name)], g))
+	}
+	if input.compared != nil {
+		result.ComparedConflicts = average(compared)
+		result.ComparedReplications = compared
+		result.Difference = result.Conflicts - result.ComparedConflicts
+		result.DifferenceStdErr = pairedStdErr(cfg, results, compared)
 	}
+	return result, nil
 }
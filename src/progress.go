@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	LineProgress  = "line"
+	JSONLProgress = "jsonl"
+	NoProgress    = "none"
+)
+
+var progressModes = []string{LineProgress, JSONLProgress, NoProgress}
+
+// ProgressEvent is a step of a sweep along with where the whole sweep
+// stands. Replication events come as every replication finishes,
+// configuration events as every result is saved and a finished event at the
+// end.
+type ProgressEvent struct {
+	Time                    time.Time `json:"time"`
+	Event                   string    `json:"event"`
+	Config                  *uint64   `json:"config,omitempty"`
+	Replication             *uint64   `json:"replication,omitempty"`
+	ConfigDuration          float64   `json:"config_duration_seconds,omitempty"`
+	CompletedConfigurations int       `json:"completed_configurations"`
+	TotalConfigurations     int       `json:"total_configurations"`
+	CompletedReplications   int       `json:"completed_replications"`
+	ExpectedReplications    int       `json:"expected_replications"`
+	EpochsPerSecond         float64   `json:"epochs_per_second"`
+	MeanConfigDuration      float64   `json:"mean_config_duration_seconds"`
+	ETASeconds              float64   `json:"eta_seconds"`
+}
+
+// ProgressReporter shows the progress of a sweep somewhere.
+type ProgressReporter interface {
+	Report(e *ProgressEvent)
+	Close() error
+}
+
+// Progress tracks how much of a sweep is done. The replications found in the
+// checkpoint count as done but not towards the throughput, which only
+// measures this session.
+type Progress struct {
+	mu                   sync.Mutex
+	reporter             ProgressReporter
+	start                time.Time
+	runs                 int
+	epochsPerReplication int
+	totalConfigs         int
+	completedConfigs     int
+	configRuns           int
+	configDurations      time.Duration
+	restored             int
+	replications         int
+	unsavedReplications  int
+}
+
+// NewProgress starts tracking a sweep of the given number of configurations,
+// reporting as the outputs' progress setting says.
+func NewProgress(cfg *ScenarioConfig, configs, restored int) (*Progress, error) {
+	p := &Progress{
+		start:                time.Now(),
+		runs:                 cfg.Replications.RunsPerSimulation,
+		epochsPerReplication: cfg.Replications.SimulationTime,
+		totalConfigs:         configs,
+		restored:             restored,
+		unsavedReplications:  restored,
+	}
+	if cfg.Compare.Enabled {
+		p.epochsPerReplication *= 2
+	}
+	switch cfg.Outputs.Progress {
+	case LineProgress:
+		p.reporter = &lineReporter{w: os.Stderr}
+	case JSONLProgress:
+		path := resultsPath(cfg, "progress.jsonl")
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		p.reporter = &jsonlReporter{f: f, enc: json.NewEncoder(f)}
+	}
+	return p, nil
+}
+
+// expected estimates the replications of the whole sweep: those of the
+// saved configurations, plus as many as they took on average (or the
+// minimum, if none was saved yet) for every other one.
+func (p *Progress) expected() int {
+	perConfig := float64(p.runs)
+	if p.completedConfigs > 0 {
+		perConfig = max(perConfig, float64(p.configRuns)/float64(p.completedConfigs))
+	}
+	remaining := int(math.Ceil(perConfig * float64(p.totalConfigs-p.completedConfigs)))
+	return p.configRuns + max(remaining, p.unsavedReplications)
+}
+
+// event fills in where the sweep stands. It must be called with mu held.
+func (p *Progress) event(name string) *ProgressEvent {
+	now := time.Now()
+	elapsed := now.Sub(p.start).Seconds()
+	e := &ProgressEvent{
+		Time:                    now,
+		Event:                   name,
+		CompletedConfigurations: p.completedConfigs,
+		TotalConfigurations:     p.totalConfigs,
+		CompletedReplications:   p.restored + p.replications,
+		ExpectedReplications:    p.expected(),
+		EpochsPerSecond:         float64(p.replications*p.epochsPerReplication) / elapsed,
+		ETASeconds:              math.NaN(),
+	}
+	if p.completedConfigs > 0 {
+		e.MeanConfigDuration = p.configDurations.Seconds() / float64(p.completedConfigs)
+	}
+	if p.replications > 0 {
+		rate := float64(p.replications) / elapsed
+		e.ETASeconds = float64(max(e.ExpectedReplications-e.CompletedReplications, 0)) / rate
+	}
+	return e
+}
+
+func (p *Progress) report(e *ProgressEvent) {
+	if p.reporter != nil {
+		p.reporter.Report(e)
+	}
+}
+
+// Record counts a finished replication, so that the progress can be kept
+// along with the checkpoint.
+func (p *Progress) Record(entry *CheckpointEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.replications++
+	p.unsavedReplications++
+	e := p.event("replication")
+	e.Config, e.Replication = &entry.Config, &entry.Replication
+	p.report(e)
+}
+
+// ConfigurationDone counts a result as saved.
+func (p *Progress) ConfigurationDone(r *Result) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.completedConfigs++
+	p.configRuns += r.Runs
+	p.unsavedReplications -= r.Runs
+	p.configDurations += r.Duration
+	e := p.event("configuration")
+	e.Config = &r.Index
+	e.ConfigDuration = r.Duration.Seconds()
+	p.report(e)
+}
+
+// Finish reports the last event, "finished" or "interrupted", and closes the
+// reporter.
+func (p *Progress) Finish(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.reporter == nil {
+		return nil
+	}
+	p.report(p.event(name))
+	return p.reporter.Close()
+}
+
+// progressRecorder counts the replications on their way to the checkpoint.
+type progressRecorder struct {
+	recorder ReplicationRecorder
+	progress *Progress
+}
+
+func (pr *progressRecorder) Record(entry *CheckpointEntry) error {
+	if err := pr.recorder.Record(entry); err != nil {
+		return err
+	}
+	pr.progress.Record(entry)
+	return nil
+}
+
+// Recorder wraps the recorder of the replications so they are counted.
+func (p *Progress) Recorder(recorder ReplicationRecorder) ReplicationRecorder {
+	return &progressRecorder{recorder, p}
+}
+
+// lineReporter keeps rewriting a single terminal line, at most every
+// lineInterval.
+type lineReporter struct {
+	w    io.Writer
+	last time.Time
+}
+
+const lineInterval = 200 * time.Millisecond
+
+func formatETA(seconds float64) string {
+	if math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return "?"
+	}
+	return (time.Duration(seconds) * time.Second).Round(time.Second).String()
+}
+
+func (lr *lineReporter) Report(e *ProgressEvent) {
+	final := e.Event != "replication" && e.Event != "configuration"
+	if !final && e.Time.Sub(lr.last) < lineInterval {
+		return
+	}
+	lr.last = e.Time
+	fmt.Fprintf(lr.w, "\r\033[K%d/%d configurations, %d/~%d replications, %.3g epochs/s, %.1fs per configuration, ETA %s",
+		e.CompletedConfigurations, e.TotalConfigurations, e.CompletedReplications, e.ExpectedReplications,
+		e.EpochsPerSecond, e.MeanConfigDuration, formatETA(e.ETASeconds))
+	if final {
+		fmt.Fprintf(lr.w, " (%s)\n", e.Event)
+	}
+}
+
+func (lr *lineReporter) Close() error {
+	return nil
+}
+
+// jsonlReporter writes every event as a JSON object on a line of its own.
+type jsonlReporter struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+func (jr *jsonlReporter) Report(e *ProgressEvent) {
+	// The ETA is unknown until the first replication finishes.
+	if math.IsNaN(e.ETASeconds) {
+		e.ETASeconds = -1
+	}
+	jr.enc.Encode(e)
+}
+
+func (jr *jsonlReporter) Close() error {
+	return jr.f.Close()
+}
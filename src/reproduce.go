@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func reproduceCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reproduce", flag.ExitOnError)
+	manifestPath := fs.String("manifest", "", "manifest of the sweep to reproduce")
+	dir := fs.String("results-dir", filepath.Join("results", "reproduced"), "directory where the reproduced results are saved")
+	goroutines := fs.Int("goroutines", 0, "number of worker goroutines, by default the manifest's")
+	fs.Parse(args)
+	if *manifestPath == "" {
+		return errors.New("reproduce needs a -manifest")
+	}
+
+	original, err := LoadManifest(*manifestPath)
+	if err != nil {
+		return err
+	}
+	if len(original.Results) == 0 {
+		return fmt.Errorf("%s lists no results files to compare", *manifestPath)
+	}
+	cfg := original.Scenario
+	if errs := cfg.Validate(); len(errs) > 0 {
+		return ConfigErrors(errs)
+	}
+	build := readBuildInfo()
+	if build.Commit != original.Build.Commit || build.Modified || original.Build.Modified {
+		fmt.Printf("Warning: the sweep was run at commit %s (modified: %t), this is %s (modified: %t)\n",
+			original.Build.Commit, original.Build.Modified, build.Commit, build.Modified)
+	}
+	if build.GoVersion != original.Build.GoVersion {
+		fmt.Printf("Warning: the sweep was built with %s, this is %s\n", original.Build.GoVersion, build.GoVersion)
+	}
+
+	cfg.Outputs.Directory = *dir
+	if cfg.Outputs.ResultsFileName == "" {
+		cfg.Outputs.ResultsFileName = strings.TrimSuffix(filepath.Base(*manifestPath), ".manifest.yaml")
+	}
+	if *goroutines > 0 {
+		cfg.Outputs.Goroutines = *goroutines
+	}
+	reproduced, err := runSweep(ctx, NewManifest(cfg), false, nil)
+	if err != nil {
+		return err
+	}
+
+	differences := 0
+	for _, result := range original.Results {
+		k := slices.IndexFunc(reproduced.Results, func(r ResultFile) bool { return r.Format == result.Format })
+		if k < 0 {
+			return fmt.Errorf("%s: the reproduced sweep wrote no %s results", result.Path, result.Format)
+		}
+		diffs, err := diffResults(result.Format, result.Path, reproduced.Results[k].Path)
+		if err != nil {
+			return err
+		}
+		if diffs == nil {
+			fmt.Printf("%s: identical\n", result.Path)
+			continue
+		}
+		differences += len(diffs)
+		fmt.Printf("%s: %d differences\n", result.Path, len(diffs))
+		for _, d := range diffs[:min(len(diffs), 10)] {
+			fmt.Println("  ", d)
+		}
+	}
+	if differences > 0 {
+		return fmt.Errorf("the reproduced results differ from the original ones")
+	}
+	return nil
+}
+
+// diffResults compares two results files of the given format, ignoring the
+// order of their records, which sweeps used to write as the workers finished
+// them.
+func diffResults(format, original, reproduced string) ([]string, error) {
+	switch format {
+	case CSVFormat:
+		return diffCSV(original, reproduced)
+	case JSONLFormat:
+		return diffRecords(original, reproduced, readRawRecords)
+	case ParquetFormat:
+		return diffRecords(original, reproduced, readParquetRecords)
+	case SQLiteFormat:
+		return diffSQLite(original, reproduced)
+	}
+	return nil, fmt.Errorf("%s: cannot compare results of format %q", original, format)
+}
+
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+func diffCSV(original, reproduced string) ([]string, error) {
+	a, err := readLines(original)
+	if err != nil {
+		return nil, err
+	}
+	b, err := readLines(reproduced)
+	if err != nil {
+		return nil, err
+	}
+	if len(a) == 0 || len(b) == 0 || a[0] != b[0] {
+		return []string{"the headers differ"}, nil
+	}
+	return diffRows(a[1:], b[1:]), nil
+}
+
+// diffRows lists the rows only in a, prefixed with "- ", and the rows only
+// in b, prefixed with "+ ", whatever their order.
+func diffRows(a, b []string) []string {
+	rowsA, rowsB := slices.Clone(a), slices.Clone(b)
+	slices.Sort(rowsA)
+	slices.Sort(rowsB)
+
+	var diffs []string
+	for len(rowsA) > 0 || len(rowsB) > 0 {
+		switch {
+		case len(rowsB) == 0 || (len(rowsA) > 0 && rowsA[0] < rowsB[0]):
+			diffs = append(diffs, "- "+rowsA[0])
+			rowsA = rowsA[1:]
+		case len(rowsA) == 0 || rowsB[0] < rowsA[0]:
+			diffs = append(diffs, "+ "+rowsB[0])
+			rowsB = rowsB[1:]
+		default:
+			rowsA, rowsB = rowsA[1:], rowsB[1:]
+		}
+	}
+	return diffs
+}
+
+// diffRecords compares two results files whose records read reads by
+// configuration index.
+func diffRecords(original, reproduced string, read func(path string) (map[int]map[string]any, error)) ([]string, error) {
+	a, err := read(original)
+	if err != nil {
+		return nil, err
+	}
+	b, err := read(reproduced)
+	if err != nil {
+		return nil, err
+	}
+	var diffs []string
+	for index, recordA := range a {
+		recordB, ok := b[index]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("configuration %d is missing", index))
+			continue
+		}
+		for key, valueA := range recordA {
+			if !reflect.DeepEqual(valueA, recordB[key]) {
+				diffs = append(diffs, fmt.Sprintf("configuration %d: %s differs", index, key))
+			}
+		}
+	}
+	for index := range b {
+		if _, ok := a[index]; !ok {
+			diffs = append(diffs, fmt.Sprintf("configuration %d is new", index))
+		}
+	}
+	slices.Sort(diffs)
+	return diffs, nil
+}
+
+// readRawRecords reads a JSON Lines results file by configuration index,
+// leaving out the timings of the runs.
+func readRawRecords(path string) (map[int]map[string]any, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+	records := make(map[int]map[string]any)
+	for _, line := range lines {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		addRawRecord(records, record)
+	}
+	return records, nil
+}
+
+func addRawRecord(records map[int]map[string]any, record map[string]any) {
+	delete(record, "started_at")
+	delete(record, "duration_seconds")
+	index, _ := record["index"].(float64)
+	records[int(index)] = record
+}
+
+// readParquetRecords reads a Parquet results file like readRawRecords, going
+// through the JSON encoding of its records.
+func readParquetRecords(path string) (map[int]map[string]any, error) {
+	rows, err := parquet.ReadFile[ResultRecord](path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	records := make(map[int]map[string]any)
+	for i := range rows {
+		data, err := json.Marshal(&rows[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		var record map[string]any
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		addRawRecord(records, record)
+	}
+	return records, nil
+}
+
+// diffSQLite compares every table of two SQLite results files row by row,
+// leaving out the timings of the runs.
+func diffSQLite(original, reproduced string) ([]string, error) {
+	var diffs []string
+	for _, table := range []string{"results", "replications", "summaries", "summary_quantiles"} {
+		a, err := readTable(original, table)
+		if err != nil {
+			return nil, err
+		}
+		b, err := readTable(reproduced, table)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range diffRows(a, b) {
+			diffs = append(diffs, table+": "+d)
+		}
+	}
+	return diffs, nil
+}
+
+// readTable returns every row of a table of a SQLite results file as a line
+// of "column=value" pairs.
+func readTable(path, table string) ([]string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT * FROM " + table)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]string, 0)
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		fields := make([]string, 0, len(columns))
+		for i, column := range columns {
+			if column == "started_at" || column == "duration_seconds" {
+				continue
+			}
+			fields = append(fields, fmt.Sprintf("%s=%v", column, values[i]))
+		}
+		lines = append(lines, strings.Join(fields, " "))
+	}
+	return lines, rows.Err()
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"go_automata/src/utils"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResultRecord is a result as the result writers store it: the parameters of
+// the configuration in the units of the scenario files, how it was run and
+// the value of every metric on each of its replications.
+type ResultRecord struct {
+	Index          int                  `json:"index" parquet:"index"`
+	Config         utils.ConfigParams   `json:"config" parquet:"config"`
+	ComparedConfig *utils.ConfigParams  `json:"compared_config,omitempty" parquet:"compared_config,optional"`
+	Point          map[string]float64   `json:"point" parquet:"point"`
+	Generator      string               `json:"generator" parquet:"generator"`
+	Antithetic     bool                 `json:"antithetic" parquet:"antithetic"`
+	SimulationTime int                  `json:"simulation_time" parquet:"simulation_time"`
+	Seeds          []uint64             `json:"seeds" parquet:"seeds,list"`
+	Runs           int                  `json:"runs" parquet:"runs"`
+	Metrics        map[string]float64   `json:"metrics" parquet:"metrics"`
+	Replications   map[string][]float64 `json:"replications" parquet:"replications"`
+	Summaries      map[string]*Summary  `json:"summaries,omitempty" parquet:"summaries,optional"`
+	Comparison     *Comparison          `json:"comparison,omitempty" parquet:"comparison,optional"`
+	StartedAt      time.Time            `json:"started_at" parquet:"started_at,timestamp"`
+	Duration       float64              `json:"duration_seconds" parquet:"duration_seconds"`
+}
+
+// Comparison holds the conflicts of the compared configuration, run with the
+// same seeds.
+type Comparison struct {
+	Conflicts        float64   `json:"conflicts" parquet:"conflicts"`
+	Replications     []float64 `json:"replications" parquet:"replications,list"`
+	Difference       float64   `json:"difference" parquet:"difference"`
+	DifferenceStdErr float64   `json:"difference_std_err" parquet:"difference_std_err"`
+}
+
+func (c *Comparison) MarshalJSON() ([]byte, error) {
+	type comparison Comparison
+	return json.Marshal(struct {
+		*comparison
+		DifferenceStdErr *float64 `json:"difference_std_err"`
+	}{(*comparison)(c), nullable(c.DifferenceStdErr)[0]})
+}
+
+// ResultWriter stores the results of a sweep as they arrive.
+type ResultWriter interface {
+	Write(record *ResultRecord) error
+	Close() error
+}
+
+const (
+	CSVFormat     = "csv"
+	JSONLFormat   = "jsonl"
+	ParquetFormat = "parquet"
+	SQLiteFormat  = "sqlite"
+)
+
+var resultFormats = []string{CSVFormat, JSONLFormat, ParquetFormat, SQLiteFormat}
+
+// Sweep holds the parameters of every configuration of a sweep, so that its
+// results can be recorded along with them.
+type Sweep struct {
+	cfg            *ScenarioConfig
+	axes           []SweepAxis
+	points         [][]float64
+	params         []utils.ConfigParams
+	comparedParams []utils.ConfigParams
+}
+
+func NewSweep(cfg *ScenarioConfig) (*Sweep, error) {
+	s := &Sweep{cfg: cfg, axes: cfg.Sweep.SweepAxes(), points: cfg.Sweep.Points()}
+	var err error
+	s.params, err = cfg.Sweep.BuildParams(cfg.Model)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Compare.Enabled {
+		s.comparedParams, err = cfg.Sweep.BuildParams(cfg.Compare.Model)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Sweep) Len() int {
+	return len(s.params)
+}
+
+func (s *Sweep) Configs() []*utils.Config {
+	return buildAll(s.params)
+}
+
+func (s *Sweep) ComparedConfigs() []*utils.Config {
+	if s.comparedParams == nil {
+		return nil
+	}
+	return buildAll(s.comparedParams)
+}
+
+func buildAll(params []utils.ConfigParams) []*utils.Config {
+	configs := make([]*utils.Config, len(params))
+	for i := range params {
+		configs[i] = params[i].Build()
+	}
+	return configs
+}
+
+func (s *Sweep) Record(r *Result) *ResultRecord {
+	record := &ResultRecord{
+		Index:          int(r.Index),
+		Config:         s.params[r.Index],
+		Point:          make(map[string]float64),
+		Generator:      s.cfg.Replications.Generator,
+		Antithetic:     s.cfg.Replications.Antithetic,
+		SimulationTime: s.cfg.Replications.SimulationTime,
+		Seeds:          r.Seeds,
+		Runs:           r.Runs,
+		Metrics:        make(map[string]float64),
+		Replications:   make(map[string][]float64),
+		StartedAt:      r.StartedAt,
+		Duration:       r.Duration.Seconds(),
+	}
+	for j, axis := range s.axes {
+		record.Point[strings.ToLower(axis.Key)] = s.points[r.Index][j]
+	}
+	for k, metric := range metrics {
+		record.Metrics[metric.Name] = r.Metrics[k]
+		record.Replications[metric.Name] = r.Replications[k]
+	}
+	if len(r.Summaries) > 0 {
+		record.Summaries = make(map[string]*Summary)
+		for k, name := range s.cfg.Outputs.Summarize {
+			record.Summaries[name] = r.Summaries[k]
+		}
+	}
+	if s.comparedParams != nil {
+		record.ComparedConfig = &s.comparedParams[r.Index]
+		record.Comparison = &Comparison{
+			Conflicts:        r.ComparedConflicts,
+			Difference:       r.Difference,
+			DifferenceStdErr: r.DifferenceStdErr,
+		}
+		for _, c := range r.ComparedReplications {
+			record.Comparison.Replications = append(record.Comparison.Replications, float64(c))
+		}
+	}
+	return record
+}
+
+// resultsPath returns the path of the results file with the given extension.
+// The extension of the configured file name, if any, is replaced.
+func resultsPath(cfg *ScenarioConfig, format string) string {
+	name := cfg.Outputs.ResultsFileName
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	return filepath.Join(cfg.Outputs.Directory, name+"."+format)
+}
+
+func NewResultWriter(format, path string, sweep *Sweep) (ResultWriter, error) {
+	switch format {
+	case CSVFormat:
+		return newCSVWriter(path, sweep)
+	case JSONLFormat:
+		return newJSONLWriter(path)
+	case ParquetFormat:
+		return newParquetWriter(path)
+	case SQLiteFormat:
+		return newSQLiteWriter(path)
+	}
+	return nil, fmt.Errorf("unknown result format %q, expected one of %v", format, resultFormats)
+}
+
+// CSVWriter writes one row per configuration with its index, the arrival
+// rates per hour, the other swept parameters, the seeds of its replications
+// and the mean (plus the summaries) of every metric.
+type CSVWriter struct {
+	f          *os.File
+	w          *bufio.Writer
+	cfg        *ScenarioConfig
+	extraAxes  []string
+	summarized map[string]bool
+}
+
+func newCSVWriter(path string, sweep *Sweep) (*CSVWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	cw := &CSVWriter{f: f, w: bufio.NewWriter(f), cfg: sweep.cfg, summarized: make(map[string]bool)}
+
+	// Swept parameters other than the arrival rates get a column of their own.
+	header := "config_index,pedestrian_arrival_rate,vehicle_arrival_rate"
+	for _, axis := range sweep.axes {
+		key := strings.ToLower(axis.Key)
+		if !strings.HasPrefix(key, "pedestrian_arrival_rate") && !strings.HasPrefix(key, "vehicle_arrival_rate") {
+			cw.extraAxes = append(cw.extraAxes, key)
+			header += "," + key
+		}
+	}
+	header += ",runs,seeds"
+	for _, name := range cw.cfg.Outputs.Summarize {
+		cw.summarized[name] = true
+	}
+	for _, metric := range metrics {
+		header += "," + metric.Name
+		if cw.summarized[metric.Name] {
+			header += summaryHeader(cw.cfg, metric.Name)
+		}
+		if cw.cfg.Outputs.ReplicationValues {
+			header += "," + metric.Name + "_replications"
+		}
+	}
+	if cw.cfg.Compare.Enabled {
+		header += ",compared_conflicts,difference,difference_std_err"
+	}
+	_, err = cw.w.WriteString(header + "\n")
+	return cw, err
+}
+
+// hourlyRate converts an arrival rate per second at each waiting area (or
+// lane) to the rate per hour over all of them.
+func hourlyRate(rate float64, sources int) string {
+	return fmt.Sprintf("%g", math.Round(rate*float64(sources)*time.Hour.Seconds()*1e6)/1e6)
+}
+
+func (cw *CSVWriter) Write(r *ResultRecord) error {
+	line := fmt.Sprintf("%d,", r.Index) + hourlyRate(r.Config.Arrivals.PedestrianArrivalRate, utils.WaitingAreas) + "," + hourlyRate(r.Config.Arrivals.VehicleArrivalRate, r.Config.Geometry.VehicleLanes)
+	for _, key := range cw.extraAxes {
+		line += fmt.Sprintf(",%g", r.Point[key])
+	}
+	line += fmt.Sprintf(",%d,%s", r.Runs, joinSeeds(r.Seeds))
+	for _, metric := range metrics {
+		line += fmt.Sprintf(",%f", r.Metrics[metric.Name])
+		if cw.summarized[metric.Name] {
+			line += r.Summaries[metric.Name].String()
+		}
+		if cw.cfg.Outputs.ReplicationValues {
+			line += "," + joinValues(r.Replications[metric.Name])
+		}
+	}
+	if c := r.Comparison; c != nil {
+		line += fmt.Sprintf(",%f,%f,%f", c.Conflicts, c.Difference, c.DifferenceStdErr)
+	}
+	_, err := cw.w.WriteString(line + "\n")
+	return err
+}
+
+func joinSeeds(seeds []uint64) string {
+	fields := make([]string, len(seeds))
+	for j, seed := range seeds {
+		fields[j] = strconv.FormatUint(seed, 10)
+	}
+	return strings.Join(fields, ";")
+}
+
+func (cw *CSVWriter) Close() error {
+	if err := cw.w.Flush(); err != nil {
+		cw.f.Close()
+		return err
+	}
+	return cw.f.Close()
+}
+
+// JSONLWriter writes every record as a JSON object on a line of its own.
+type JSONLWriter struct {
+	f   *os.File
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func newJSONLWriter(path string) (*JSONLWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	return &JSONLWriter{f, w, json.NewEncoder(w)}, nil
+}
+
+func (jw *JSONLWriter) Write(r *ResultRecord) error {
+	return jw.enc.Encode(r)
+}
+
+func (jw *JSONLWriter) Close() error {
+	if err := jw.w.Flush(); err != nil {
+		jw.f.Close()
+		return err
+	}
+	return jw.f.Close()
+}
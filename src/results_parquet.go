@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// ParquetWriter writes every record as a row of a Parquet file, with the
+// schema of ResultRecord.
+type ParquetWriter struct {
+	f *os.File
+	w *parquet.GenericWriter[ResultRecord]
+}
+
+func newParquetWriter(path string) (*ParquetWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ParquetWriter{f, parquet.NewGenericWriter[ResultRecord](f)}, nil
+}
+
+func (pw *ParquetWriter) Write(r *ResultRecord) error {
+	_, err := pw.w.Write([]ResultRecord{*r})
+	return err
+}
+
+func (pw *ParquetWriter) Close() error {
+	if err := pw.w.Close(); err != nil {
+		pw.f.Close()
+		return err
+	}
+	return pw.f.Close()
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"go_automata/src/utils"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteWriter stores the records in a SQLite database with four tables:
+// results, with one row per configuration holding its parameters and the
+// mean of every metric; replications, with the seed and metrics of every
+// run; and summaries and summary_quantiles, with the distribution of the
+// summarized metrics. Every table is keyed by config_index.
+type SQLiteWriter struct {
+	db *sql.DB
+}
+
+func configColumns(prefix string) []string {
+	var params utils.ConfigParams
+	columns := make([]string, 0)
+	for _, o := range params.Overrides() {
+		columns = append(columns, prefix+strings.ToLower(o.Key))
+	}
+	return columns
+}
+
+func configValues(params *utils.ConfigParams) []any {
+	values := make([]any, 0)
+	for _, o := range params.Overrides() {
+		switch v := o.Value.(type) {
+		case *int:
+			values = append(values, *v)
+		case *float64:
+			values = append(values, *v)
+		case *string:
+			values = append(values, *v)
+		}
+	}
+	return values
+}
+
+// sqlFloat stores the values that could not be computed as NULL.
+func sqlFloat(v float64) any {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return v
+}
+
+func metricColumns() []string {
+	columns := make([]string, len(metrics))
+	for k, metric := range metrics {
+		columns[k] = metric.Name
+	}
+	return columns
+}
+
+func createTable(name string, columns []string) string {
+	return fmt.Sprintf("CREATE TABLE %s (%s)", name, strings.Join(columns, ", "))
+}
+
+func insert(name string, columns []string) string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", name, strings.Join(columns, ", "), placeholders)
+}
+
+func resultColumns() []string {
+	columns := []string{"config_index"}
+	columns = append(columns, configColumns("")...)
+	columns = append(columns, configColumns("compared_")...)
+	columns = append(columns, "point", "generator", "antithetic", "simulation_time", "runs", "started_at", "duration_seconds")
+	columns = append(columns, metricColumns()...)
+	return append(columns, "compared_conflicts", "difference", "difference_std_err")
+}
+
+func replicationColumns() []string {
+	columns := []string{"config_index", "replication", "seed"}
+	columns = append(columns, metricColumns()...)
+	return append(columns, "compared_conflicts")
+}
+
+var summaryColumns = []string{"config_index", "metric", "std_dev", "std_err", "ci_low", "ci_high", "bootstrap_low", "bootstrap_high", "median"}
+
+var quantileColumns = []string{"config_index", "metric", "level", "value"}
+
+func newSQLiteWriter(path string) (*SQLiteWriter, error) {
+	// A previous study must not be mixed up with this one.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	statements := []string{
+		createTable("results", append([]string{"config_index INTEGER PRIMARY KEY"}, resultColumns()[1:]...)),
+		createTable("replications", append(replicationColumns(), "PRIMARY KEY (config_index, replication)")),
+		createTable("summaries", append(summaryColumns, "PRIMARY KEY (config_index, metric)")),
+		createTable("summary_quantiles", append(quantileColumns, "PRIMARY KEY (config_index, metric, level)")),
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return &SQLiteWriter{db}, nil
+}
+
+func (sw *SQLiteWriter) Write(r *ResultRecord) error {
+	tx, err := sw.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := writeRecord(tx, r); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func writeRecord(tx *sql.Tx, r *ResultRecord) error {
+	point, err := json.Marshal(r.Point)
+	if err != nil {
+		return err
+	}
+	row := []any{r.Index}
+	row = append(row, configValues(&r.Config)...)
+	if r.ComparedConfig != nil {
+		row = append(row, configValues(r.ComparedConfig)...)
+	} else {
+		row = append(row, make([]any, len(configColumns("")))...)
+	}
+	row = append(row, string(point), r.Generator, r.Antithetic, r.SimulationTime, r.Runs, r.StartedAt.Format(time.RFC3339Nano), r.Duration)
+	for _, metric := range metrics {
+		row = append(row, sqlFloat(r.Metrics[metric.Name]))
+	}
+	if c := r.Comparison; c != nil {
+		row = append(row, c.Conflicts, c.Difference, sqlFloat(c.DifferenceStdErr))
+	} else {
+		row = append(row, nil, nil, nil)
+	}
+	if _, err := tx.Exec(insert("results", resultColumns()), row...); err != nil {
+		return err
+	}
+
+	for j, seed := range r.Seeds {
+		row := []any{r.Index, j, int64(seed)}
+		for _, metric := range metrics {
+			row = append(row, sqlFloat(r.Replications[metric.Name][j]))
+		}
+		if r.Comparison != nil {
+			row = append(row, r.Comparison.Replications[j])
+		} else {
+			row = append(row, nil)
+		}
+		if _, err := tx.Exec(insert("replications", replicationColumns()), row...); err != nil {
+			return err
+		}
+	}
+
+	for name, s := range r.Summaries {
+		row := []any{r.Index, name}
+		for _, v := range []float64{s.StdDev, s.StdErr, s.TLow, s.THigh, s.BootstrapLow, s.BootstrapHigh, s.Median} {
+			row = append(row, sqlFloat(v))
+		}
+		if _, err := tx.Exec(insert("summaries", summaryColumns), row...); err != nil {
+			return err
+		}
+		for k, level := range s.QuantileLevels {
+			if _, err := tx.Exec(insert("summary_quantiles", quantileColumns), r.Index, name, level, sqlFloat(s.Quantiles[k])); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (sw *SQLiteWriter) Close() error {
+	return sw.db.Close()
+}
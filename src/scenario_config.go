@@ -1,44 +1,313 @@
 package main
 
 import (
+	"cmp"
 	"fmt"
+	"go_automata/src/generator"
 	"go_automata/src/utils"
+	"os"
+	"slices"
+
+	"gopkg.in/yaml.v3"
 )
 
+// SweepConfig describes the configurations a study simulates. Design is
+// grid (every combination of the axes' values), lhs (Latin hypercube) or
+// sobol, the last two drawing Samples points. Without Axes, the arrival
+// rates are swept from their initial to their final values.
+type SweepConfig struct {
+	InitialPedestrianArrivalRateHr int         `yaml:"initial_pedestrian_arrival_rate_hr"`
+	FinalPedestrianArrivalRateHr   int         `yaml:"final_pedestrian_arrival_rate_hr"`
+	InitialVehicleArrivalRateHr    int         `yaml:"initial_vehicle_arrival_rate_hr"`
+	FinalVehicleArrivalRateHr      int         `yaml:"final_vehicle_arrival_rate_hr"`
+	PointsPerAxis                  int         `yaml:"points_per_axis"`
+	Design                         string      `yaml:"design"`
+	Samples                        int         `yaml:"samples"`
+	Seed                           int         `yaml:"seed"`
+	Axes                           []SweepAxis `yaml:"axes,omitempty"`
+}
+
+// ReplicationConfig describes the runs of every configuration. With a
+// TargetHalfWidth, RunsPerSimulation is only the minimum: replications are
+// added until the confidence interval of TargetMetric is at most that wide
+// on each side, or MaxRunsPerSimulation is reached. A replication that takes
+// longer than RunTimeout seconds abandons its configuration.
+type ReplicationConfig struct {
+	RunsPerSimulation    int     `yaml:"runs_per_simulation"`
+	SimulationTime       int     `yaml:"simulation_time"`
+	Generator            string  `yaml:"generator"`
+	Antithetic           bool    `yaml:"antithetic"`
+	TargetHalfWidth      float64 `yaml:"target_half_width"`
+	TargetMetric         string  `yaml:"target_metric"`
+	MaxRunsPerSimulation int     `yaml:"max_runs_per_simulation"`
+	RunTimeout           float64 `yaml:"run_timeout"`
+}
+
+// CompareConfig describes the configuration every sweep cell is compared
+// against. Its parameters default to the ones of the scenario.
+type CompareConfig struct {
+	Enabled bool               `yaml:"enabled"`
+	Model   utils.ConfigParams `yaml:",inline"`
+}
+
+// OutputConfig describes the results files, one per format in Formats. In
+// the CSV file, every metric gets a column with
+// its mean over the replications, and the ones listed in Summarize also get
+// their standard deviation, standard error, t-based and bootstrap confidence
+// intervals at ConfidenceLevel, median and Quantiles. Progress tells how the
+// progress of a sweep is reported while it runs.
+type OutputConfig struct {
+	ResultsFileName    string    `yaml:"results_file_name"`
+	Directory          string    `yaml:"directory"`
+	Formats            []string  `yaml:"formats"`
+	Goroutines         int       `yaml:"goroutines"`
+	Summarize          []string  `yaml:"summarize"`
+	ConfidenceLevel    float64   `yaml:"confidence_level"`
+	BootstrapResamples int       `yaml:"bootstrap_resamples"`
+	Quantiles          []float64 `yaml:"quantiles"`
+	ReplicationValues  bool      `yaml:"replication_values"`
+	Progress           string    `yaml:"progress"`
+}
+
+// ScenarioConfig describes a whole study. It is read from a YAML (or JSON)
+// scenario file, and every field can be overridden by the environment
+// variable named after its key in uppercase.
 type ScenarioConfig struct {
-	InitialPedestrianArrivalRateHr int
-	FinalPedestrianArrivalRateHr   int
-	InitialVehicleArrivalRateHr    int
-	FinalVehicleArrivalRateHr      int
-	RunsPerSimulation              int
-	SimulationTime                 int
-}
-
-func NewScenarioConfigFromEnv() *ScenarioConfig {
-	initialPedestrianArrivalRateHr := utils.GetEnvIntOrDefault("INITIAL_PEDESTRIAN_ARRIVAL_RATE_HR", 1000)
-	finalPedestrianArrivalRateHr := utils.GetEnvIntOrDefault("FINAL_PEDESTRIAN_ARRIVAL_RATE_HR", 6000)
-	initialVehicleArrivalRateHr := utils.GetEnvIntOrDefault("INITIAL_VEHICLE_ARRIVAL_RATE_HR", 200)
-	finalVehicleArrivalRateHr := utils.GetEnvIntOrDefault("FINAL_VEHICLE_ARRIVAL_RATE_HR", 1400)
-	runsPerSimulation := utils.GetEnvIntOrDefault("RUNS_PER_SIMULATION", 30)
-	simulationTime := utils.GetEnvIntOrDefault("SIMULATION_TIME", 3600)
+	Model        utils.ConfigParams `yaml:",inline"`
+	Sweep        SweepConfig        `yaml:"sweep"`
+	Replications ReplicationConfig  `yaml:"replications"`
+	Compare      CompareConfig      `yaml:"compare"`
+	Outputs      OutputConfig       `yaml:"outputs"`
+}
+
+func DefaultScenarioConfig() *ScenarioConfig {
 	return &ScenarioConfig{
-		initialPedestrianArrivalRateHr,
-		finalPedestrianArrivalRateHr,
-		initialVehicleArrivalRateHr,
-		finalVehicleArrivalRateHr,
-		runsPerSimulation,
-		simulationTime,
+		Model: utils.DefaultConfigParams(),
+		Sweep: SweepConfig{
+			InitialPedestrianArrivalRateHr: 1000,
+			FinalPedestrianArrivalRateHr:   6000,
+			InitialVehicleArrivalRateHr:    200,
+			FinalVehicleArrivalRateHr:      1400,
+			PointsPerAxis:                  30,
+			Design:                         GridDesign,
+			Seed:                           9000000,
+		},
+		Replications: ReplicationConfig{
+			RunsPerSimulation:    30,
+			SimulationTime:       3600,
+			Generator:            generator.DefaultName,
+			TargetMetric:         "conflicts",
+			MaxRunsPerSimulation: seedsPerConfiguration,
+		},
+		Outputs: OutputConfig{
+			Goroutines:         20,
+			Directory:          "results",
+			Formats:            []string{CSVFormat},
+			Summarize:          []string{"conflicts"},
+			ConfidenceLevel:    0.95,
+			BootstrapResamples: 1000,
+			Quantiles:          []float64{0.05, 0.25, 0.75, 0.95},
+			Progress:           LineProgress,
+		},
+	}
+}
+
+func (s *ScenarioConfig) Overrides() []utils.Override {
+	overrides := s.Model.Overrides()
+	return append(overrides,
+		utils.Override{Key: "INITIAL_PEDESTRIAN_ARRIVAL_RATE_HR", Usage: "first pedestrian arrival rate of the sweep (cap/hr)", Value: &s.Sweep.InitialPedestrianArrivalRateHr},
+		utils.Override{Key: "FINAL_PEDESTRIAN_ARRIVAL_RATE_HR", Usage: "last pedestrian arrival rate of the sweep (cap/hr)", Value: &s.Sweep.FinalPedestrianArrivalRateHr},
+		utils.Override{Key: "INITIAL_VEHICLE_ARRIVAL_RATE_HR", Usage: "first vehicle arrival rate of the sweep (veh/hr)", Value: &s.Sweep.InitialVehicleArrivalRateHr},
+		utils.Override{Key: "FINAL_VEHICLE_ARRIVAL_RATE_HR", Usage: "last vehicle arrival rate of the sweep (veh/hr)", Value: &s.Sweep.FinalVehicleArrivalRateHr},
+		utils.Override{Key: "POINTS_PER_AXIS", Usage: "values of each arrival rate in the default sweep", Value: &s.Sweep.PointsPerAxis},
+		utils.Override{Key: "SWEEP_DESIGN", Usage: "sweep design (grid, lhs or sobol)", Value: &s.Sweep.Design},
+		utils.Override{Key: "SWEEP_SAMPLES", Usage: "points drawn by the lhs and sobol designs", Value: &s.Sweep.Samples},
+		utils.Override{Key: "SWEEP_SEED", Usage: "seed of the lhs design", Value: &s.Sweep.Seed},
+		utils.Override{Key: "RUNS_PER_SIMULATION", Usage: "replications of every configuration", Value: &s.Replications.RunsPerSimulation},
+		utils.Override{Key: "SIMULATION_TIME", Usage: "simulated seconds per replication", Value: &s.Replications.SimulationTime},
+		utils.Override{Key: "GENERATOR", Usage: fmt.Sprintf("random number generator %v", generator.Names()), Value: &s.Replications.Generator},
+		utils.Override{Key: "TARGET_HALF_WIDTH", Usage: "add replications until the confidence interval half-width of the target metric is below this (0 disables)", Value: &s.Replications.TargetHalfWidth},
+		utils.Override{Key: "TARGET_METRIC", Usage: "metric whose confidence interval stops the replications", Value: &s.Replications.TargetMetric},
+		utils.Override{Key: "MAX_RUNS_PER_SIMULATION", Usage: "maximum replications of every configuration with a target half-width", Value: &s.Replications.MaxRunsPerSimulation},
+		utils.Override{Key: "RUN_TIMEOUT", Usage: "seconds a replication may take before its configuration is abandoned (0 disables)", Value: &s.Replications.RunTimeout},
+		utils.Override{Key: "ANTITHETIC", Usage: "make odd replications antithetic to the previous one", Value: &s.Replications.Antithetic},
+		utils.Override{Key: "COMPARE", Usage: "compare every configuration against the COMPARE_* parameters", Value: &s.Compare.Enabled},
+		utils.Override{Key: "RESULTS_FILE_NAME", Usage: "name of the results file inside the results directory", Value: &s.Outputs.ResultsFileName},
+		utils.Override{Key: "RESULTS_DIR", Usage: "directory where the results and their manifest are saved", Value: &s.Outputs.Directory},
+		utils.Override{Key: "GOROUTINES", Usage: "number of worker goroutines", Value: &s.Outputs.Goroutines},
+		utils.Override{Key: "RESULT_FORMATS", Usage: fmt.Sprintf("comma-separated result formats %v", resultFormats), Value: &s.Outputs.Formats},
+		utils.Override{Key: "SUMMARIZE", Usage: "comma-separated metrics whose distribution is written to the results", Value: &s.Outputs.Summarize},
+		utils.Override{Key: "CONFIDENCE_LEVEL", Usage: "confidence level of the intervals in the results", Value: &s.Outputs.ConfidenceLevel},
+		utils.Override{Key: "BOOTSTRAP_RESAMPLES", Usage: "resamples of the bootstrap confidence intervals", Value: &s.Outputs.BootstrapResamples},
+		utils.Override{Key: "REPLICATION_VALUES", Usage: "write the value of every replication to the results", Value: &s.Outputs.ReplicationValues},
+		utils.Override{Key: "PROGRESS", Usage: fmt.Sprintf("how the progress of a sweep is reported %v", progressModes), Value: &s.Outputs.Progress},
+	)
+}
+
+// LoadScenarioConfig reads the scenario file at path, if any, on top of the
+// defaults and then applies the overrides found through lookup. The compared
+// parameters start from the scenario ones, then take the file's compare
+// section and finally the COMPARE_-prefixed overrides.
+func LoadScenarioConfig(path string, lookup utils.Lookup) (*ScenarioConfig, error) {
+	s := DefaultScenarioConfig()
+	var compareNode struct {
+		Compare yaml.Node `yaml:"compare"`
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(data, s); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := yaml.Unmarshal(data, &compareNode); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if err := utils.ApplyOverrides(s.Overrides(), lookup); err != nil {
+		return nil, err
+	}
+
+	s.Compare.Model = s.Model
+	if !compareNode.Compare.IsZero() {
+		if err := compareNode.Compare.Decode(&s.Compare); err != nil {
+			return nil, fmt.Errorf("%s: compare: %w", path, err)
+		}
+		// The section's enabled flag must not win over the COMPARE override.
+		overrides := s.Overrides()
+		k := slices.IndexFunc(overrides, func(o utils.Override) bool { return o.Key == "COMPARE" })
+		if err := utils.ApplyOverrides(overrides[k:k+1], lookup); err != nil {
+			return nil, err
+		}
+	}
+	comparedLookup := func(key string) (string, bool) {
+		return lookup("COMPARE_" + key)
+	}
+	if err := utils.ApplyOverrides(s.Compare.Model.Overrides(), comparedLookup); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func NewScenarioConfigFromEnv() (*ScenarioConfig, error) {
+	path := ""
+	if scenarioFile := utils.GetEnvStr("SCENARIO_FILE"); scenarioFile != nil {
+		path = *scenarioFile
 	}
+	return LoadScenarioConfig(path, utils.EnvLookup(""))
 }
 
 func (s *ScenarioConfig) Print() {
 	println("Running with the following configuration:")
-	println("Initial pedestrian arrival rate:", s.InitialPedestrianArrivalRateHr, "cap/hr")
-	println("Final pedestrian arrival rate:", s.FinalPedestrianArrivalRateHr, "cap/hr")
-	println("Initial vehicle arrival rate:", s.InitialVehicleArrivalRateHr, "veh/hr")
-	println("Final vehicle arrival rate:", s.FinalVehicleArrivalRateHr, "veh/hr")
-	println("Runs per simulation:", s.RunsPerSimulation)
-	println("Simulation time:", s.SimulationTime, "seconds")
-	println("Green light time:", utils.GetEnvIntOrDefault("GREEN_LIGHT_TIME", 50), " seconds")
-	fmt.Printf("Crosswalk width: %.1f meters\n", float64(utils.GetEnvIntOrDefault("CROSSWALK_ROWS", 6))/2)
+	println("Sweep design:", s.Sweep.Design)
+	for _, axis := range s.Sweep.SweepAxes() {
+		if len(axis.Values) > 0 {
+			fmt.Printf("Sweeping %s over %v\n", axis.Key, axis.Values)
+		} else {
+			fmt.Printf("Sweeping %s from %g to %g (%d values, %s scale)\n", axis.Key, axis.From, axis.To, axis.Count, cmp.Or(axis.Scale, LinearScale))
+		}
+	}
+	println("Runs per simulation:", s.Replications.RunsPerSimulation)
+	if s.Replications.TargetHalfWidth > 0 {
+		fmt.Printf("Adding runs, up to %d, until the %s half-width is at most %g\n", s.Replications.MaxRunsPerSimulation, s.Replications.TargetMetric, s.Replications.TargetHalfWidth)
+	}
+	println("Simulation time:", s.Replications.SimulationTime, "seconds")
+	if s.Replications.RunTimeout > 0 {
+		fmt.Printf("Abandoning configurations whose replications take over %g seconds\n", s.Replications.RunTimeout)
+	}
+	println("Generator:", s.Replications.Generator)
+	println("Antithetic variates:", s.Replications.Antithetic)
+	println("Green light time:", s.Model.Signal.GreenLightTime, " seconds")
+	fmt.Printf("Crosswalk width: %.1f meters\n", float64(s.Model.Geometry.CrosswalkRows)/2)
+	println("Update scheme:", s.Model.Dynamics.UpdateScheme)
+	if s.Compare.Enabled {
+		println("Compared green light time:", s.Compare.Model.Signal.GreenLightTime, " seconds")
+		fmt.Printf("Compared crosswalk width: %.1f meters\n", float64(s.Compare.Model.Geometry.CrosswalkRows)/2)
+		println("Compared update scheme:", s.Compare.Model.Dynamics.UpdateScheme)
+	}
+}
+
+// Validate checks the whole study up front, so that no worker starts with a
+// configuration that would fail or silently misbehave.
+func (s *ScenarioConfig) Validate() []error {
+	errs := s.Model.Validate()
+	if s.Compare.Enabled {
+		for _, err := range s.Compare.Model.Validate() {
+			errs = append(errs, fmt.Errorf("compare: %w", err))
+		}
+	}
+
+	errs = append(errs, s.Sweep.Validate()...)
+	if len(errs) == 0 {
+		if _, err := s.Sweep.BuildConfigs(s.Model); err != nil {
+			errs = append(errs, err)
+		}
+		if s.Compare.Enabled {
+			if _, err := s.Sweep.BuildConfigs(s.Compare.Model); err != nil {
+				errs = append(errs, fmt.Errorf("compare: %w", err))
+			}
+		}
+	}
+
+	if s.Replications.RunsPerSimulation <= 0 {
+		errs = append(errs, fmt.Errorf("runs per simulation must be positive, got %d", s.Replications.RunsPerSimulation))
+	}
+	if s.Replications.RunsPerSimulation > seedsPerConfiguration {
+		errs = append(errs, fmt.Errorf("runs per simulation must be at most %d, got %d", seedsPerConfiguration, s.Replications.RunsPerSimulation))
+	}
+	if s.Replications.TargetHalfWidth < 0 {
+		errs = append(errs, fmt.Errorf("target half-width must not be negative, got %g", s.Replications.TargetHalfWidth))
+	}
+	if metricIndex(s.Replications.TargetMetric) < 0 {
+		errs = append(errs, fmt.Errorf("unknown target metric %q", s.Replications.TargetMetric))
+	}
+	if s.Replications.TargetHalfWidth > 0 {
+		maxRuns := s.Replications.MaxRunsPerSimulation
+		if maxRuns < s.Replications.RunsPerSimulation || maxRuns > seedsPerConfiguration {
+			errs = append(errs, fmt.Errorf("max runs per simulation must be between the runs per simulation and %d, got %d", seedsPerConfiguration, maxRuns))
+		}
+	}
+	if s.Replications.RunTimeout < 0 {
+		errs = append(errs, fmt.Errorf("run timeout must not be negative, got %g", s.Replications.RunTimeout))
+	}
+	if s.Replications.SimulationTime <= 0 {
+		errs = append(errs, fmt.Errorf("simulation time must be positive, got %d", s.Replications.SimulationTime))
+	}
+	if _, err := generator.Lookup(s.Replications.Generator); err != nil {
+		errs = append(errs, err)
+	}
+	if s.Outputs.Goroutines <= 0 {
+		errs = append(errs, fmt.Errorf("goroutines must be positive, got %d", s.Outputs.Goroutines))
+	}
+	if len(s.Outputs.Formats) == 0 {
+		errs = append(errs, fmt.Errorf("at least one result format is needed"))
+	}
+	for _, format := range s.Outputs.Formats {
+		if !slices.Contains(resultFormats, format) {
+			errs = append(errs, fmt.Errorf("unknown result format %q, expected one of %v", format, resultFormats))
+		}
+	}
+	for _, name := range s.Outputs.Summarize {
+		if metricIndex(name) < 0 {
+			errs = append(errs, fmt.Errorf("unknown metric %q to summarize", name))
+		}
+	}
+	if s.Outputs.ConfidenceLevel <= 0 || s.Outputs.ConfidenceLevel >= 1 {
+		errs = append(errs, fmt.Errorf("confidence level must be between 0 and 1, got %g", s.Outputs.ConfidenceLevel))
+	}
+	if !slices.Contains(progressModes, s.Outputs.Progress) {
+		errs = append(errs, fmt.Errorf("unknown progress mode %q, expected one of %v", s.Outputs.Progress, progressModes))
+	}
+	if s.Outputs.BootstrapResamples <= 0 {
+		errs = append(errs, fmt.Errorf("bootstrap resamples must be positive, got %d", s.Outputs.BootstrapResamples))
+	}
+	for _, q := range s.Outputs.Quantiles {
+		if q < 0 || q > 1 {
+			errs = append(errs, fmt.Errorf("quantiles must be between 0 and 1, got %g", q))
+		}
+	}
+	return errs
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func mapLookup(values map[string]string) func(key string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := values[key]
+		return v, ok
+	}
+}
+
+func TestLoadScenarioConfigCompare(t *testing.T) {
+	comparePath := filepath.Join("..", "scenarios", "compare.yaml")
+	tests := []struct {
+		name           string
+		path           string
+		values         map[string]string
+		enabled        bool
+		greenLightTime int
+		comparedGreen  int
+		comparedRows   int
+	}{
+		{"file", comparePath, nil, true, 50, 35, 10},
+		{"compare override disables the file's section", comparePath, map[string]string{"COMPARE": "false"}, false, 50, 35, 10},
+		{"scenario override reaches the compared model", comparePath, map[string]string{"GREEN_LIGHT_TIME": "40", "CROSSWALK_COLS": "48"}, true, 40, 35, 10},
+		{"compared override wins over the file", comparePath, map[string]string{"COMPARE_GREEN_LIGHT_TIME": "30"}, true, 50, 30, 10},
+		{"compare override without a file", "", map[string]string{"COMPARE": "true", "COMPARE_CROSSWALK_ROWS": "8"}, true, 50, 50, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := LoadScenarioConfig(tt.path, mapLookup(tt.values))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Compare.Enabled != tt.enabled {
+				t.Errorf("compare enabled = %t, want %t", s.Compare.Enabled, tt.enabled)
+			}
+			if got := s.Model.Signal.GreenLightTime; got != tt.greenLightTime {
+				t.Errorf("green light time = %d, want %d", got, tt.greenLightTime)
+			}
+			if got := s.Compare.Model.Signal.GreenLightTime; got != tt.comparedGreen {
+				t.Errorf("compared green light time = %d, want %d", got, tt.comparedGreen)
+			}
+			if got := s.Compare.Model.Geometry.CrosswalkRows; got != tt.comparedRows {
+				t.Errorf("compared crosswalk rows = %d, want %d", got, tt.comparedRows)
+			}
+			if got, want := s.Compare.Model.Geometry.CrosswalkCols, s.Model.Geometry.CrosswalkCols; got != want {
+				t.Errorf("compared crosswalk cols = %d, want the scenario's %d", got, want)
+			}
+		})
+	}
+}
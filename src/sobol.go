@@ -0,0 +1,68 @@
+package main
+
+// sobolDirections holds the primitive polynomial degree s, its coefficients
+// a and the initial direction numbers m of dimensions 2 onwards, taken from
+// Joe and Kuo's new-joe-kuo-6.21201 table. Dimension 1 is the van der
+// Corput sequence.
+var sobolDirections = []struct {
+	s int
+	a uint32
+	m []uint32
+}{
+	{1, 0, []uint32{1}},
+	{2, 1, []uint32{1, 3}},
+	{3, 1, []uint32{1, 3, 1}},
+	{3, 2, []uint32{1, 1, 1}},
+	{4, 1, []uint32{1, 1, 3, 3}},
+	{4, 4, []uint32{1, 3, 5, 13}},
+	{5, 2, []uint32{1, 1, 5, 5, 17}},
+	{5, 4, []uint32{1, 1, 5, 5, 5}},
+	{5, 7, []uint32{1, 1, 7, 11, 19}},
+}
+
+const sobolBits = 32
+
+func sobolDirectionNumbers(dim int) []uint32 {
+	v := make([]uint32, sobolBits)
+	if dim == 0 {
+		for i := range v {
+			v[i] = 1 << (sobolBits - 1 - i)
+		}
+		return v
+	}
+	d := sobolDirections[dim-1]
+	for i := 0; i < d.s && i < sobolBits; i++ {
+		v[i] = d.m[i] << (sobolBits - 1 - i)
+	}
+	for i := d.s; i < sobolBits; i++ {
+		v[i] = v[i-d.s] ^ (v[i-d.s] >> d.s)
+		for k := 1; k < d.s; k++ {
+			v[i] ^= ((d.a >> (d.s - 1 - k)) & 1) * v[i-k]
+		}
+	}
+	return v
+}
+
+// sobolPoints returns the first samples points of the Sobol sequence
+// (skipping the origin) mapped onto the axes, using Gray code ordering.
+func sobolPoints(axes []SweepAxis, samples int) [][]float64 {
+	directions := make([][]uint32, len(axes))
+	for j := range axes {
+		directions[j] = sobolDirectionNumbers(j)
+	}
+	x := make([]uint32, len(axes))
+	points := make([][]float64, samples)
+	for i := 0; i < samples; i++ {
+		c := 0
+		for n := i; n&1 == 1; n >>= 1 {
+			c++
+		}
+		point := make([]float64, len(axes))
+		for j := range axes {
+			x[j] ^= directions[j][c]
+			point[j] = axes[j].Quantile(float64(x[j]) / (1 << sobolBits))
+		}
+		points[i] = point
+	}
+	return points
+}
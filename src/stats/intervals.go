@@ -0,0 +1,132 @@
+package stats
+
+import (
+	"go_automata/src/generator"
+	"math"
+)
+
+// TInterval returns the confidence interval of the mean of values at the
+// given level, based on Student's t distribution.
+func TInterval(values []float64, level float64) (float64, float64) {
+	halfWidth := THalfWidth(values, level)
+	mean := Mean(values)
+	return mean - halfWidth, mean + halfWidth
+}
+
+// THalfWidth returns the half-width of the t-based confidence interval of
+// the mean of values at the given level.
+func THalfWidth(values []float64, level float64) float64 {
+	if len(values) < 2 {
+		return math.NaN()
+	}
+	return TQuantile(1-(1-level)/2, float64(len(values)-1)) * StdErr(values)
+}
+
+// BootstrapInterval returns the percentile bootstrap confidence interval of
+// the mean of values at the given level, drawing the resamples from g.
+func BootstrapInterval(values []float64, level float64, resamples int, g generator.Generator) (float64, float64) {
+	if len(values) < 2 {
+		return math.NaN(), math.NaN()
+	}
+	means := make([]float64, resamples)
+	for i := range means {
+		total := 0.0
+		for range values {
+			total += values[g.RandInt(0, len(values))]
+		}
+		means[i] = total / float64(len(values))
+	}
+	alpha := 1 - level
+	return Quantile(means, alpha/2), Quantile(means, 1-alpha/2)
+}
+
+// TCDF is the cumulative distribution function of Student's t distribution
+// with df degrees of freedom.
+func TCDF(t, df float64) float64 {
+	tail := 0.5 * betaI(df/2, 0.5, df/(df+t*t))
+	if t > 0 {
+		return 1 - tail
+	}
+	return tail
+}
+
+// TQuantile inverts TCDF by bisection, widening the bracket until it holds
+// the quantile: with few degrees of freedom the tails are long, and a 99.99%
+// interval with one degree of freedom already needs t₀.₉₉₉₉₅,₁ ≈ 6366.
+func TQuantile(p, df float64) float64 {
+	if p <= 0 {
+		return math.Inf(-1)
+	}
+	if p >= 1 {
+		return math.Inf(1)
+	}
+	lo, hi := -1.0, 1.0
+	for TCDF(lo, df) > p {
+		lo *= 2
+	}
+	for TCDF(hi, df) < p {
+		hi *= 2
+	}
+	for i := 0; i < 200 && hi-lo > 1e-12; i++ {
+		mid := (lo + hi) / 2
+		if TCDF(mid, df) < p {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// betaI is the regularized incomplete beta function I_x(a, b).
+func betaI(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	if x < (a+1)/(a+b+2) {
+		return front * betaCF(a, b, x) / a
+	}
+	return 1 - front*betaCF(b, a, 1-x)/b
+}
+
+// betaCF evaluates the continued fraction of the incomplete beta function
+// with the modified Lentz method.
+func betaCF(a, b, x float64) float64 {
+	const tiny = 1e-300
+	c := 1.0
+	d := 1 - (a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m < 1000; m++ {
+		fm := float64(m)
+		for _, num := range []float64{
+			fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm)),
+			-(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1)),
+		} {
+			d = 1 + num*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + num/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			h *= d * c
+		}
+		if math.Abs(d*c-1) < 1e-15 {
+			break
+		}
+	}
+	return h
+}
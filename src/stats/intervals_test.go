@@ -0,0 +1,64 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+// tTable holds two-sided critical values of Student's t distribution from
+// the usual printed tables, rounded to three decimals.
+var tTable = []struct {
+	p, df, t float64
+}{
+	{0.975, 1, 12.706},
+	{0.975, 2, 4.303},
+	{0.975, 5, 2.571},
+	{0.975, 10, 2.228},
+	{0.975, 29, 2.045},
+	{0.975, 120, 1.980},
+	{0.95, 29, 1.699},
+	{0.995, 29, 2.756},
+	{0.9995, 1, 636.619},
+	{0.9995, 4, 8.610},
+	{0.99995, 1, 6366.198},
+}
+
+func TestTQuantileMatchesTable(t *testing.T) {
+	for _, tt := range tTable {
+		if got := TQuantile(tt.p, tt.df); math.Abs(got-tt.t) > 5e-4 {
+			t.Errorf("TQuantile(%g, %g) = %.4f, want %.3f", tt.p, tt.df, got, tt.t)
+		}
+		if got := TQuantile(1-tt.p, tt.df); math.Abs(got+tt.t) > 5e-4 {
+			t.Errorf("TQuantile(%g, %g) = %.4f, want %.3f", 1-tt.p, tt.df, got, -tt.t)
+		}
+	}
+}
+
+func TestTCDFMatchesTable(t *testing.T) {
+	for _, tt := range tTable {
+		if got := TCDF(tt.t, tt.df); math.Abs(got-tt.p) > 0.01*(1-tt.p) {
+			t.Errorf("TCDF(%g, %g) = %.6f, want %g", tt.t, tt.df, got, tt.p)
+		}
+		if got := TCDF(-tt.t, tt.df); math.Abs(got-(1-tt.p)) > 0.01*(1-tt.p) {
+			t.Errorf("TCDF(%g, %g) = %.6f, want %g", -tt.t, tt.df, got, 1-tt.p)
+		}
+	}
+	if got := TCDF(0, 7); got != 0.5 {
+		t.Errorf("TCDF(0, 7) = %g, want 0.5", got)
+	}
+}
+
+// With one and two degrees of freedom the quantile has a closed form.
+func TestTQuantileClosedForms(t *testing.T) {
+	for _, p := range []float64{0.6, 0.9, 0.99, 0.9999, 0.999999} {
+		cauchy := math.Tan(math.Pi * (p - 0.5))
+		if got := TQuantile(p, 1); math.Abs(got-cauchy) > 1e-9*math.Max(1, cauchy) {
+			t.Errorf("TQuantile(%g, 1) = %g, want %g", p, got, cauchy)
+		}
+		a := 4 * p * (1 - p)
+		two := 2 * (p - 0.5) * math.Sqrt(2/a)
+		if got := TQuantile(p, 2); math.Abs(got-two) > 1e-9*math.Max(1, two) {
+			t.Errorf("TQuantile(%g, 2) = %g, want %g", p, got, two)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package stats
+
+import (
+	"math"
+	"slices"
+)
+
+func Mean(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total / float64(len(values))
+}
+
+// / Returns the sample standard deviation (n-1 denominator)
+func StdDev(values []float64) float64 {
+	if len(values) < 2 {
+		return math.NaN()
+	}
+	mean := Mean(values)
+	total := 0.0
+	for _, v := range values {
+		total += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(total / float64(len(values)-1))
+}
+
+func StdErr(values []float64) float64 {
+	return StdDev(values) / math.Sqrt(float64(len(values)))
+}
+
+// Quantile returns the q-th sample quantile, interpolating linearly between
+// the order statistics.
+func Quantile(values []float64, q float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	h := q * float64(len(sorted)-1)
+	lo := int(math.Floor(h))
+	if lo+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lo] + (h-float64(lo))*(sorted[lo+1]-sorted[lo])
+}
+
+func Median(values []float64) float64 {
+	return Quantile(values, 0.5)
+}
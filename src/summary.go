@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go_automata/src/generator"
+	"go_automata/src/stats"
+	"math"
+	"strings"
+)
+
+// Summary describes the distribution of a metric over the replications of a
+// configuration.
+type Summary struct {
+	StdDev         float64   `json:"std_dev" parquet:"std_dev"`
+	StdErr         float64   `json:"std_err" parquet:"std_err"`
+	TLow           float64   `json:"ci_low" parquet:"ci_low"`
+	THigh          float64   `json:"ci_high" parquet:"ci_high"`
+	BootstrapLow   float64   `json:"bootstrap_low" parquet:"bootstrap_low"`
+	BootstrapHigh  float64   `json:"bootstrap_high" parquet:"bootstrap_high"`
+	Median         float64   `json:"median" parquet:"median"`
+	QuantileLevels []float64 `json:"quantile_levels" parquet:"quantile_levels,list"`
+	Quantiles      []float64 `json:"quantiles" parquet:"quantiles,list"`
+}
+
+// MarshalJSON writes the values that could not be computed, such as the
+// intervals of a single replication, as null.
+func (s *Summary) MarshalJSON() ([]byte, error) {
+	v := nullable(s.StdDev, s.StdErr, s.TLow, s.THigh, s.BootstrapLow, s.BootstrapHigh, s.Median)
+	return json.Marshal(map[string]any{
+		"std_dev":         v[0],
+		"std_err":         v[1],
+		"ci_low":          v[2],
+		"ci_high":         v[3],
+		"bootstrap_low":   v[4],
+		"bootstrap_high":  v[5],
+		"median":          v[6],
+		"quantile_levels": s.QuantileLevels,
+		"quantiles":       nullable(s.Quantiles...),
+	})
+}
+
+// replicationUnits returns the independent observations the inference on
+// values is based on: the replications themselves or, with antithetic
+// variates, the mean of each antithetic pair.
+func replicationUnits(cfg *ScenarioConfig, values []float64) []float64 {
+	if !cfg.Replications.Antithetic {
+		return values
+	}
+	units := make([]float64, 0, (len(values)+1)/2)
+	for j, v := range values {
+		if j%2 == 1 {
+			units[len(units)-1] = (units[len(units)-1] + v) / 2
+		} else {
+			units = append(units, v)
+		}
+	}
+	return units
+}
+
+// summarize describes values, drawing the bootstrap resamples from g.
+func summarize(cfg *ScenarioConfig, values []float64, g generator.Generator) *Summary {
+	level := cfg.Outputs.ConfidenceLevel
+	units := replicationUnits(cfg, values)
+	s := &Summary{
+		StdDev: stats.StdDev(values),
+		StdErr: stats.StdErr(units),
+		Median: stats.Median(values),
+	}
+	s.TLow, s.THigh = stats.TInterval(units, level)
+	s.BootstrapLow, s.BootstrapHigh = stats.BootstrapInterval(units, level, cfg.Outputs.BootstrapResamples, g)
+	for _, q := range cfg.Outputs.Quantiles {
+		s.QuantileLevels = append(s.QuantileLevels, q)
+		s.Quantiles = append(s.Quantiles, stats.Quantile(values, q))
+	}
+	return s
+}
+
+// nullable points to each of values, or is nil where they are NaN, which
+// JSON cannot represent.
+func nullable(values ...float64) []*float64 {
+	out := make([]*float64, len(values))
+	for k := range values {
+		if !math.IsNaN(values[k]) {
+			out[k] = &values[k]
+		}
+	}
+	return out
+}
+
+func summaryHeader(cfg *ScenarioConfig, name string) string {
+	columns := []string{"std_dev", "std_err", "ci_low", "ci_high", "bootstrap_low", "bootstrap_high", "median"}
+	for _, q := range cfg.Outputs.Quantiles {
+		columns = append(columns, fmt.Sprintf("q%g", q*100))
+	}
+	header := ""
+	for _, column := range columns {
+		header += fmt.Sprintf(",%s_%s", name, column)
+	}
+	return header
+}
+
+func (s *Summary) String() string {
+	line := fmt.Sprintf(",%f,%f,%f,%f,%f,%f,%f", s.StdDev, s.StdErr, s.TLow, s.THigh, s.BootstrapLow, s.BootstrapHigh, s.Median)
+	for _, q := range s.Quantiles {
+		line += fmt.Sprintf(",%f", q)
+	}
+	return line
+}
+
+// joinValues writes the replications of a metric in a single CSV field.
+func joinValues(values []float64) string {
+	fields := make([]string, len(values))
+	for j, v := range values {
+		fields[j] = fmt.Sprintf("%g", v)
+	}
+	return strings.Join(fields, ";")
+}
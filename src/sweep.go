@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"go_automata/src/generator"
+	"go_automata/src/utils"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SweepAxis describes the values one parameter takes in a sweep. Key is the
+// name of any scenario override (e.g. green_light_time), or one of the
+// arrival rates measured per hour (pedestrian_arrival_rate_hr and
+// vehicle_arrival_rate_hr). An explicit list of Values takes precedence over
+// the From/To range.
+type SweepAxis struct {
+	Key    string    `yaml:"key"`
+	Scale  string    `yaml:"scale,omitempty"`
+	From   float64   `yaml:"from"`
+	To     float64   `yaml:"to"`
+	Count  int       `yaml:"count,omitempty"`
+	Values []float64 `yaml:"values,omitempty"`
+}
+
+const (
+	LinearScale = "linear"
+	LogScale    = "log"
+
+	GridDesign   = "grid"
+	LHSDesign    = "lhs"
+	SobolDesign  = "sobol"
+	hourlyRateHr = "_HR"
+)
+
+// linSpace returns n evenly spaced values from start to end, both included.
+// The last value is end itself, which adding up the steps can miss by a
+// rounding error.
+func linSpace(start, end float64, n int) []float64 {
+	if n <= 0 {
+		return nil
+	}
+	if n == 1 {
+		return []float64{start}
+	}
+	step := (end - start) / float64(n-1)
+	result := make([]float64, 0)
+	for i := 0; i < n-1; i++ {
+		result = append(result, start+float64(i)*step)
+	}
+	return append(result, end)
+}
+
+// logSpace returns n values from start to end, both included, evenly spaced
+// on a log scale.
+func logSpace(start, end float64, n int) []float64 {
+	result := linSpace(math.Log(start), math.Log(end), n)
+	for i := range result {
+		result[i] = math.Exp(result[i])
+	}
+	if n > 0 {
+		result[0] = start
+	}
+	if n > 1 {
+		result[n-1] = end
+	}
+	return result
+}
+
+func (a *SweepAxis) GridValues() []float64 {
+	if len(a.Values) > 0 {
+		return a.Values
+	}
+	if a.Scale == LogScale {
+		return logSpace(a.From, a.To, a.Count)
+	}
+	return linSpace(a.From, a.To, a.Count)
+}
+
+// Quantile maps u in [0, 1) to a value of the axis, used by the sampling
+// designs.
+func (a *SweepAxis) Quantile(u float64) float64 {
+	if len(a.Values) > 0 {
+		return a.Values[min(int(u*float64(len(a.Values))), len(a.Values)-1)]
+	}
+	if a.Scale == LogScale {
+		return math.Exp(math.Log(a.From) + u*(math.Log(a.To)-math.Log(a.From)))
+	}
+	return a.From + u*(a.To-a.From)
+}
+
+func (a *SweepAxis) Validate(design string) []error {
+	var errs []error
+	if a.Scale != "" && a.Scale != LinearScale && a.Scale != LogScale {
+		errs = append(errs, fmt.Errorf("sweep axis %s: unknown scale %q, must be %s or %s", a.Key, a.Scale, LinearScale, LogScale))
+	}
+	if len(a.Values) == 0 {
+		if design == GridDesign && a.Count <= 0 {
+			errs = append(errs, fmt.Errorf("sweep axis %s: count must be positive when no values are given, got %d", a.Key, a.Count))
+		}
+		if a.Scale == LogScale && (a.From <= 0 || a.To <= 0) {
+			errs = append(errs, fmt.Errorf("sweep axis %s: a log scale needs positive bounds, got %g and %g", a.Key, a.From, a.To))
+		}
+	}
+	params := utils.DefaultConfigParams()
+	if _, err := axisOverride(&params, a.Key); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// axisOverride finds the override of params that an axis sets. Rates per
+// hour over the whole crosswalk are split over its waiting areas or lanes, as
+// params has them when the value is set, and converted to rates per second.
+func axisOverride(params *utils.ConfigParams, key string) (*sweepTarget, error) {
+	key = strings.ToUpper(key)
+	var sources func(g utils.Geometry) int
+	switch key {
+	case "PEDESTRIAN_ARRIVAL_RATE" + hourlyRateHr:
+		key, sources = "PEDESTRIAN_ARRIVAL_RATE", func(utils.Geometry) int { return utils.WaitingAreas }
+	case "VEHICLE_ARRIVAL_RATE" + hourlyRateHr:
+		key, sources = "VEHICLE_ARRIVAL_RATE", func(g utils.Geometry) int { return g.VehicleLanes }
+	}
+	for _, o := range params.Overrides() {
+		if o.Key != key {
+			continue
+		}
+		if _, ok := o.Value.(*string); ok {
+			return nil, fmt.Errorf("cannot sweep %q, it is not a number", strings.ToLower(key))
+		}
+		return &sweepTarget{o, params, sources}, nil
+	}
+	return nil, fmt.Errorf("cannot sweep unknown parameter %q", strings.ToLower(key))
+}
+
+type sweepTarget struct {
+	override utils.Override
+	params   *utils.ConfigParams
+	sources  func(g utils.Geometry) int
+}
+
+// hourly tells whether the axis gives a rate per hour.
+func (t *sweepTarget) hourly() bool {
+	return t.sources != nil
+}
+
+func (t *sweepTarget) Set(value float64) error {
+	if t.hourly() {
+		value *= 1 / (float64(t.sources(t.params.Geometry)) * time.Hour.Seconds())
+	}
+	if _, ok := t.override.Value.(*int); ok {
+		return t.override.Set(strconv.Itoa(int(math.Round(value))))
+	}
+	return t.override.Set(strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// Axes returns the axes of the sweep. When none are given, the legacy
+// arrival rate ranges are swept on a PointsPerAxis x PointsPerAxis grid.
+func (s *SweepConfig) SweepAxes() []SweepAxis {
+	if len(s.Axes) > 0 {
+		return s.Axes
+	}
+	return []SweepAxis{
+		{Key: "pedestrian_arrival_rate_hr", From: float64(s.InitialPedestrianArrivalRateHr), To: float64(s.FinalPedestrianArrivalRateHr), Count: s.PointsPerAxis},
+		{Key: "vehicle_arrival_rate_hr", From: float64(s.InitialVehicleArrivalRateHr), To: float64(s.FinalVehicleArrivalRateHr), Count: s.PointsPerAxis},
+	}
+}
+
+// Points returns every point of the sweep, each one holding a value per
+// axis in the order of SweepAxes. Values of integer parameters are rounded.
+func (s *SweepConfig) Points() [][]float64 {
+	axes := s.SweepAxes()
+	var points [][]float64
+	switch s.Design {
+	case LHSDesign:
+		points = latinHypercube(axes, s.Samples, uint64(s.Seed))
+	case SobolDesign:
+		points = sobolPoints(axes, s.Samples)
+	default:
+		points = gridPoints(axes)
+	}
+
+	params := utils.DefaultConfigParams()
+	for j, axis := range axes {
+		target, err := axisOverride(&params, axis.Key)
+		if err != nil || target.hourly() {
+			continue
+		}
+		if _, ok := target.override.Value.(*int); ok {
+			for _, point := range points {
+				point[j] = math.Round(point[j])
+			}
+		}
+	}
+	return points
+}
+
+func gridPoints(axes []SweepAxis) [][]float64 {
+	points := [][]float64{{}}
+	for _, axis := range axes {
+		next := make([][]float64, 0)
+		for _, point := range points {
+			for _, value := range axis.GridValues() {
+				next = append(next, append(slices.Clone(point), value))
+			}
+		}
+		points = next
+	}
+	return points
+}
+
+func latinHypercube(axes []SweepAxis, samples int, seed uint64) [][]float64 {
+	g := generator.NewXoshiro256(seed)
+	points := make([][]float64, samples)
+	for i := range points {
+		points[i] = make([]float64, len(axes))
+	}
+	for j, axis := range axes {
+		strata := make([]int, samples)
+		for i := range strata {
+			strata[i] = i
+		}
+		for i := samples - 1; i > 0; i-- {
+			k := g.RandInt(0, i+1)
+			strata[i], strata[k] = strata[k], strata[i]
+		}
+		for i := range points {
+			points[i][j] = axis.Quantile((float64(strata[i]) + g.Random()) / float64(samples))
+		}
+	}
+	return points
+}
+
+func (s *SweepConfig) Validate() []error {
+	var errs []error
+	axes := s.SweepAxes()
+	keys := make([]string, 0)
+	for i := range axes {
+		errs = append(errs, axes[i].Validate(s.Design)...)
+		key := strings.ToLower(axes[i].Key)
+		if slices.Contains(keys, key) {
+			errs = append(errs, fmt.Errorf("parameter %s is swept more than once", key))
+		}
+		keys = append(keys, key)
+	}
+	switch s.Design {
+	case GridDesign:
+	case LHSDesign, SobolDesign:
+		if s.Samples <= 0 {
+			errs = append(errs, fmt.Errorf("the %s design needs a positive amount of samples, got %d", s.Design, s.Samples))
+		}
+		if s.Design == SobolDesign && len(axes) > len(sobolDirections)+1 {
+			errs = append(errs, fmt.Errorf("the sobol design supports up to %d axes, got %d", len(sobolDirections)+1, len(axes)))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown sweep design %q, must be %s, %s or %s", s.Design, GridDesign, LHSDesign, SobolDesign))
+	}
+	return errs
+}
+
+// BuildParams returns the parameters of every point of the sweep, starting
+// from params. Rates per hour are set last, once the point's geometry is.
+func (s *SweepConfig) BuildParams(params utils.ConfigParams) ([]utils.ConfigParams, error) {
+	axes := s.SweepAxes()
+	points := make([]utils.ConfigParams, 0)
+	for _, point := range s.Points() {
+		p := params
+		targets := make([]*sweepTarget, len(axes))
+		for j, axis := range axes {
+			target, err := axisOverride(&p, axis.Key)
+			if err != nil {
+				return nil, err
+			}
+			targets[j] = target
+		}
+		for _, hourly := range []bool{false, true} {
+			for j, target := range targets {
+				if target.hourly() != hourly {
+					continue
+				}
+				if err := target.Set(point[j]); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if errs := p.Validate(); len(errs) > 0 {
+			return nil, fmt.Errorf("sweep point %v: %w", point, errs[0])
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+func (s *SweepConfig) BuildConfigs(params utils.ConfigParams) ([]*utils.Config, error) {
+	points, err := s.BuildParams(params)
+	if err != nil {
+		return nil, err
+	}
+	configs := make([]*utils.Config, len(points))
+	for i := range points {
+		configs[i] = points[i].Build()
+	}
+	return configs, nil
+}
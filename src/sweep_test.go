@@ -0,0 +1,121 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestLinSpace(t *testing.T) {
+	tests := []struct {
+		start, end float64
+		n          int
+		want       []float64
+	}{
+		{0, 1, 5, []float64{0, 0.25, 0.5, 0.75, 1}},
+		{100, 3600, 3, []float64{100, 1850, 3600}},
+		{50, 7, 2, []float64{50, 7}},
+		{0.3, 2.9, 1, []float64{0.3}},
+	}
+	for _, tt := range tests {
+		if got := linSpace(tt.start, tt.end, tt.n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("linSpace(%g, %g, %d) = %v, want %v", tt.start, tt.end, tt.n, got, tt.want)
+		}
+	}
+}
+
+// Adding up the steps misses the end of these ranges by a rounding error.
+func TestLinSpaceIncludesEnd(t *testing.T) {
+	tests := []struct {
+		start, end float64
+		n          int
+	}{
+		{0.1, 0.9, 12},
+		{1, 1000, 14},
+		{100, 3600, 28},
+		{50, 7, 38},
+	}
+	for _, tt := range tests {
+		got := linSpace(tt.start, tt.end, tt.n)
+		if len(got) != tt.n || got[0] != tt.start || got[tt.n-1] != tt.end {
+			t.Errorf("linSpace(%g, %g, %d) = %v, want %d values from %g to %g", tt.start, tt.end, tt.n, got, tt.n, tt.start, tt.end)
+		}
+	}
+}
+
+func TestLogSpace(t *testing.T) {
+	tests := []struct {
+		start, end float64
+		n          int
+		want       []float64
+	}{
+		{1, 1000, 4, []float64{1, 10, 100, 1000}},
+		{0.01, 100, 5, []float64{0.01, 0.1, 1, 10, 100}},
+		{2, 32, 5, []float64{2, 4, 8, 16, 32}},
+		{3600, 36, 3, []float64{3600, 360, 36}},
+	}
+	for _, tt := range tests {
+		got := logSpace(tt.start, tt.end, tt.n)
+		if len(got) != len(tt.want) || got[0] != tt.start || got[len(got)-1] != tt.end {
+			t.Errorf("logSpace(%g, %g, %d) = %v, want %v", tt.start, tt.end, tt.n, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if math.Abs(got[i]-tt.want[i]) > 1e-12*tt.want[i] {
+				t.Errorf("logSpace(%g, %g, %d) = %v, want %v", tt.start, tt.end, tt.n, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// Every axis of a Latin hypercube splits its range into as many strata as
+// samples, and puts exactly one sample in each.
+func TestLatinHypercubeHitsEveryStratumOnce(t *testing.T) {
+	axes := []SweepAxis{
+		{Key: "green_light_time", From: 10, To: 90},
+		{Key: "pedestrian_arrival_rate_hr", From: 100, To: 3600},
+		{Key: "vehicle_arrival_rate_hr", Scale: LogScale, From: 60, To: 6000},
+	}
+	for _, samples := range []int{1, 7, 50} {
+		for _, seed := range []uint64{1, 42, 9000000} {
+			points := latinHypercube(axes, samples, seed)
+			if len(points) != samples {
+				t.Fatalf("%d samples, seed %d: got %d points", samples, seed, len(points))
+			}
+			for j, axis := range axes {
+				hits := make([]int, samples)
+				for _, point := range points {
+					u := (point[j] - axis.From) / (axis.To - axis.From)
+					if axis.Scale == LogScale {
+						u = math.Log(point[j]/axis.From) / math.Log(axis.To/axis.From)
+					}
+					hits[min(int(u*float64(samples)), samples-1)]++
+				}
+				for stratum, n := range hits {
+					if n != 1 {
+						t.Errorf("%d samples, seed %d, axis %s: stratum %d hit %d times, want once", samples, seed, axis.Key, stratum, n)
+					}
+				}
+			}
+		}
+	}
+}
+
+// The first points of the Sobol sequence of Joe and Kuo's table, origin
+// excluded, in Gray code order.
+func TestSobolPointsMatchPublishedValues(t *testing.T) {
+	want := [][]float64{
+		{0.5, 0.5, 0.5},
+		{0.75, 0.25, 0.25},
+		{0.25, 0.75, 0.75},
+		{0.375, 0.375, 0.625},
+		{0.875, 0.875, 0.125},
+		{0.625, 0.125, 0.875},
+		{0.125, 0.625, 0.375},
+	}
+	axes := []SweepAxis{{From: 0, To: 1}, {From: 0, To: 1}, {From: 0, To: 1}}
+	if got := sobolPoints(axes, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("sobolPoints = %v, want %v", got, want)
+	}
+}
@@ -1,5 +1,22 @@
 package utils
 
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// The update schemes decide in which order the agents think and move on
+// every epoch, see model.UpdateScheme.
+const (
+	RandomSequentialUpdate = "random-sequential"
+	SynchronousUpdate      = "synchronous"
+	VehiclesFirstUpdate    = "vehicles-first"
+	PedestriansFirstUpdate = "pedestrians-first"
+)
+
+var UpdateSchemes = []string{RandomSequentialUpdate, SynchronousUpdate, VehiclesFirstUpdate, PedestriansFirstUpdate}
+
 type Config struct {
 	CrosswalkProt         *Rectangle
 	VehicleLaneProt       *Rectangle
@@ -9,6 +26,7 @@ type Config struct {
 	GreenLightTime        int
 	PedestrianArrivalRate float64
 	VehicleArrivalRate    float64
+	UpdateScheme          string
 }
 
 func NewConfig(
@@ -19,7 +37,8 @@ func NewConfig(
 	stopLightCycle int,
 	greenLightTime int,
 	pedestrianArrivalRate,
-	vehicleArrivalRate float64) *Config {
+	vehicleArrivalRate float64,
+	updateScheme string) *Config {
 	return &Config{
 		crosswalkProt,
 		vehicleLaneProt,
@@ -29,6 +48,7 @@ func NewConfig(
 		greenLightTime,
 		pedestrianArrivalRate,
 		vehicleArrivalRate,
+		updateScheme,
 	}
 }
 
@@ -54,35 +74,61 @@ func (c *Config) Duplicate() *Config {
 		c.GreenLightTime,
 		c.PedestrianArrivalRate,
 		c.VehicleArrivalRate,
+		c.UpdateScheme,
 	)
 }
 
-func NewConfigFromEnv() *Config {
-	crosswalkRows := GetEnvIntOrDefault("CROSSWALK_ROWS", 6)
-	crosswalkCols := GetEnvIntOrDefault("CROSSWALK_COLS", 42)
-	waitingAreaCols := GetEnvIntOrDefault("WAITING_AREA_COLS", 1)
-	vehicleLanes := GetEnvIntOrDefault("VEHICLE_LANES", 6)
-	vehicleRows := GetEnvIntOrDefault("VEHICLE_ROWS", 6)
-	vehicleCols := GetEnvIntOrDefault("VEHICLE_COLS", 5)
-	stopLightCycle := GetEnvIntOrDefault("STOP_LIGHT_CYCLE", 90)
-	greenLightTime := GetEnvIntOrDefault("GREEN_LIGHT_TIME", 50)
-	pedestrianArrivalRate := GetEnvFloatOrDefault("PEDESTRIAN_ARRIVAL_RATE", 2000.0/(2*3600))
-	vehicleArrivalRate := GetEnvFloatOrDefault("VEHICLE_ARRIVAL_RATE", 1400.0/(6*3600))
-
-	vehicleLaneCols := crosswalkCols / vehicleLanes
-	crosswalkPrototype := NewRectangle(crosswalkRows, crosswalkCols)
-	vehicleLanePrototype := NewRectangle(2*vehicleRows+crosswalkPrototype.Rows(), vehicleLaneCols)
-	waitingAreaPrototype := NewRectangle(crosswalkRows, waitingAreaCols)
-	vehiclePrototype := NewRectangle(vehicleRows, vehicleCols)
+// NewConfigFromEnv builds the default configuration with the overrides set
+// in the environment, failing if one of them is malformed or the result is
+// not a valid configuration.
+func NewConfigFromEnv() (*Config, error) {
+	params := DefaultConfigParams()
+	if err := ApplyOverrides(params.Overrides(), EnvLookup("")); err != nil {
+		return nil, err
+	}
+	if errs := params.Validate(); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return params.Build(), nil
+}
 
-	return NewConfig(
-		crosswalkPrototype,
-		vehicleLanePrototype,
-		waitingAreaPrototype,
-		vehiclePrototype,
-		stopLightCycle,
-		greenLightTime,
-		pedestrianArrivalRate,
-		vehicleArrivalRate,
-	)
+// Validate checks the geometric and timing invariants the model relies on
+// and returns a human readable error for each one that does not hold.
+func (c *Config) Validate() []error {
+	var errs []error
+	if c.CrosswalkProt.Rows() <= 0 || c.CrosswalkProt.Cols() <= 0 {
+		errs = append(errs, fmt.Errorf("crosswalk must have at least one row and column, got %dx%d", c.CrosswalkProt.Rows(), c.CrosswalkProt.Cols()))
+	}
+	if c.VehicleProt.Rows() <= 0 || c.VehicleProt.Cols() <= 0 {
+		errs = append(errs, fmt.Errorf("vehicles must have at least one row and column, got %dx%d", c.VehicleProt.Rows(), c.VehicleProt.Cols()))
+	}
+	if c.VehicleLaneProt.Cols() <= 0 {
+		errs = append(errs, fmt.Errorf("vehicle lanes must be at least one column wide, got %d", c.VehicleLaneProt.Cols()))
+	} else {
+		if c.CrosswalkProt.Cols()%c.VehicleLaneProt.Cols() != 0 {
+			errs = append(errs, fmt.Errorf("crosswalk columns (%d) are not a multiple of the vehicle lane width (%d), the last %d columns would have no lane", c.CrosswalkProt.Cols(), c.VehicleLaneProt.Cols(), c.CrosswalkProt.Cols()%c.VehicleLaneProt.Cols()))
+		}
+		if c.VehicleProt.Cols() > c.VehicleLaneProt.Cols() {
+			errs = append(errs, fmt.Errorf("vehicles (%d columns) are wider than their lanes (%d columns)", c.VehicleProt.Cols(), c.VehicleLaneProt.Cols()))
+		}
+	}
+	if c.WaitingAreaProt.Cols() < 0 {
+		errs = append(errs, fmt.Errorf("waiting area columns must not be negative, got %d", c.WaitingAreaProt.Cols()))
+	}
+	if c.StopLightCycle <= 0 {
+		errs = append(errs, fmt.Errorf("stop light cycle must be positive, got %d", c.StopLightCycle))
+	}
+	if c.GreenLightTime <= 0 || c.GreenLightTime >= c.StopLightCycle {
+		errs = append(errs, fmt.Errorf("green light time must be between 1 and the stop light cycle minus one (%d), got %d", c.StopLightCycle-1, c.GreenLightTime))
+	}
+	if c.PedestrianArrivalRate < 0 {
+		errs = append(errs, fmt.Errorf("pedestrian arrival rate must not be negative, got %g", c.PedestrianArrivalRate))
+	}
+	if c.VehicleArrivalRate < 0 {
+		errs = append(errs, fmt.Errorf("vehicle arrival rate must not be negative, got %g", c.VehicleArrivalRate))
+	}
+	if !slices.Contains(UpdateSchemes, c.UpdateScheme) {
+		errs = append(errs, fmt.Errorf("unknown update scheme %q, expected one of %v", c.UpdateScheme, UpdateSchemes))
+	}
+	return errs
 }
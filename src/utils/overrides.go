@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Override binds an environment variable (or any other key/value source) to
+// a configuration field. Value must be a *int, *float64, *bool, *string or
+// *[]string, the last one set from a comma-separated list.
+type Override struct {
+	Key   string
+	Usage string
+	Value any
+}
+
+type Lookup func(key string) (string, bool)
+
+func EnvLookup(prefix string) Lookup {
+	return func(key string) (string, bool) {
+		return os.LookupEnv(prefix + key)
+	}
+}
+
+func (o *Override) Set(raw string) error {
+	switch v := o.Value.(type) {
+	case *int:
+		r, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		*v = r
+	case *float64:
+		r, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		*v = r
+	case *bool:
+		r, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		*v = r
+	case *string:
+		*v = raw
+	case *[]string:
+		*v = nil
+		for _, field := range strings.Split(raw, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				*v = append(*v, field)
+			}
+		}
+	default:
+		panic(fmt.Sprintf("unsupported override type %T for %s", o.Value, o.Key))
+	}
+	return nil
+}
+
+func ApplyOverrides(overrides []Override, lookup Lookup) error {
+	var errs []error
+	for _, o := range overrides {
+		raw, ok := lookup(o.Key)
+		if !ok || raw == "" {
+			continue
+		}
+		if err := o.Set(raw); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value %q for %s: %w", raw, o.Key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
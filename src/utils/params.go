@@ -0,0 +1,120 @@
+package utils
+
+import "fmt"
+
+type Geometry struct {
+	CrosswalkRows   int `yaml:"crosswalk_rows" json:"crosswalk_rows" parquet:"crosswalk_rows"`
+	CrosswalkCols   int `yaml:"crosswalk_cols" json:"crosswalk_cols" parquet:"crosswalk_cols"`
+	WaitingAreaCols int `yaml:"waiting_area_cols" json:"waiting_area_cols" parquet:"waiting_area_cols"`
+	VehicleLanes    int `yaml:"vehicle_lanes" json:"vehicle_lanes" parquet:"vehicle_lanes"`
+	VehicleRows     int `yaml:"vehicle_rows" json:"vehicle_rows" parquet:"vehicle_rows"`
+	VehicleCols     int `yaml:"vehicle_cols" json:"vehicle_cols" parquet:"vehicle_cols"`
+}
+
+// WaitingAreas is the number of waiting areas, one on each side of the
+// crosswalk. The pedestrian arrival rate is per waiting area, as the vehicle
+// arrival rate is per lane.
+const WaitingAreas = 2
+
+type Signal struct {
+	StopLightCycle int `yaml:"stop_light_cycle" json:"stop_light_cycle" parquet:"stop_light_cycle"`
+	GreenLightTime int `yaml:"green_light_time" json:"green_light_time" parquet:"green_light_time"`
+}
+
+// Dynamics holds the rules the agents follow as the epochs pass.
+type Dynamics struct {
+	UpdateScheme string `yaml:"update_scheme" json:"update_scheme" parquet:"update_scheme"`
+}
+
+type Arrivals struct {
+	PedestrianArrivalRate float64 `yaml:"pedestrian_arrival_rate" json:"pedestrian_arrival_rate" parquet:"pedestrian_arrival_rate"`
+	VehicleArrivalRate    float64 `yaml:"vehicle_arrival_rate" json:"vehicle_arrival_rate" parquet:"vehicle_arrival_rate"`
+}
+
+// ConfigParams holds the parameters a Config is built from, as they are
+// written in scenario files and environment variables.
+type ConfigParams struct {
+	Geometry Geometry `yaml:"geometry" json:"geometry" parquet:"geometry"`
+	Signal   Signal   `yaml:"signal" json:"signal" parquet:"signal"`
+	Arrivals Arrivals `yaml:"arrivals" json:"arrivals" parquet:"arrivals"`
+	Dynamics Dynamics `yaml:"dynamics" json:"dynamics" parquet:"dynamics"`
+}
+
+func DefaultConfigParams() ConfigParams {
+	return ConfigParams{
+		Geometry: Geometry{
+			CrosswalkRows:   6,
+			CrosswalkCols:   42,
+			WaitingAreaCols: 1,
+			VehicleLanes:    6,
+			VehicleRows:     6,
+			VehicleCols:     5,
+		},
+		Signal: Signal{
+			StopLightCycle: 90,
+			GreenLightTime: 50,
+		},
+		Arrivals: Arrivals{
+			PedestrianArrivalRate: 2000.0 / (2 * 3600),
+			VehicleArrivalRate:    1400.0 / (6 * 3600),
+		},
+		Dynamics: Dynamics{
+			UpdateScheme: RandomSequentialUpdate,
+		},
+	}
+}
+
+func (p *ConfigParams) Overrides() []Override {
+	return []Override{
+		{"CROSSWALK_ROWS", "crosswalk rows (cells of 0.5 m)", &p.Geometry.CrosswalkRows},
+		{"CROSSWALK_COLS", "crosswalk columns (cells of 0.5 m)", &p.Geometry.CrosswalkCols},
+		{"WAITING_AREA_COLS", "waiting area columns", &p.Geometry.WaitingAreaCols},
+		{"VEHICLE_LANES", "number of vehicle lanes", &p.Geometry.VehicleLanes},
+		{"VEHICLE_ROWS", "vehicle length in cells", &p.Geometry.VehicleRows},
+		{"VEHICLE_COLS", "vehicle width in cells", &p.Geometry.VehicleCols},
+		{"STOP_LIGHT_CYCLE", "stop light cycle in seconds", &p.Signal.StopLightCycle},
+		{"GREEN_LIGHT_TIME", "pedestrian green light time in seconds", &p.Signal.GreenLightTime},
+		{"PEDESTRIAN_ARRIVAL_RATE", "pedestrian arrivals per second at each waiting area", &p.Arrivals.PedestrianArrivalRate},
+		{"VEHICLE_ARRIVAL_RATE", "vehicle arrivals per second at each lane", &p.Arrivals.VehicleArrivalRate},
+		{"UPDATE_SCHEME", fmt.Sprintf("order in which the agents are updated %v", UpdateSchemes), &p.Dynamics.UpdateScheme},
+	}
+}
+
+func (p *ConfigParams) Build() *Config {
+	g := p.Geometry
+	vehicleLaneCols := g.CrosswalkCols / g.VehicleLanes
+	crosswalkPrototype := NewRectangle(g.CrosswalkRows, g.CrosswalkCols)
+	vehicleLanePrototype := NewRectangle(2*g.VehicleRows+crosswalkPrototype.Rows(), vehicleLaneCols)
+	waitingAreaPrototype := NewRectangle(g.CrosswalkRows, g.WaitingAreaCols)
+	vehiclePrototype := NewRectangle(g.VehicleRows, g.VehicleCols)
+
+	return NewConfig(
+		crosswalkPrototype,
+		vehicleLanePrototype,
+		waitingAreaPrototype,
+		vehiclePrototype,
+		p.Signal.StopLightCycle,
+		p.Signal.GreenLightTime,
+		p.Arrivals.PedestrianArrivalRate,
+		p.Arrivals.VehicleArrivalRate,
+		p.Dynamics.UpdateScheme,
+	)
+}
+
+// Validate checks the parameters that would make Build fail or silently
+// change the geometry, and then the invariants of the built Config.
+func (p *ConfigParams) Validate() []error {
+	g := p.Geometry
+	if g.VehicleLanes <= 0 {
+		return []error{fmt.Errorf("there must be at least one vehicle lane, got %d", g.VehicleLanes)}
+	}
+	if g.VehicleLanes > g.CrosswalkCols {
+		return []error{fmt.Errorf("%d vehicle lanes do not fit in %d crosswalk columns", g.VehicleLanes, g.CrosswalkCols)}
+	}
+	var errs []error
+	laneCols := g.CrosswalkCols / g.VehicleLanes
+	if g.CrosswalkCols%g.VehicleLanes != 0 && g.CrosswalkCols%laneCols == 0 {
+		errs = append(errs, fmt.Errorf("crosswalk columns (%d) cannot be split evenly into %d vehicle lanes, %d lanes would be built", g.CrosswalkCols, g.VehicleLanes, g.CrosswalkCols/laneCols))
+	}
+	return append(errs, p.Build().Validate()...)
+}
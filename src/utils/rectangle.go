@@ -1,5 +1,7 @@
 package utils
 
+import "fmt"
+
 func abs(a int) int {
 	if a < 0 {
 		return -a
@@ -90,14 +92,14 @@ func (r *Rectangle) Duplicate() *Rectangle {
 	return NewRectangleWithPoints(r.UpperLeft, r.LowerRight)
 }
 
-func (r *Rectangle) DistanceTo(point Point) int {
+func (r *Rectangle) DistanceTo(point Point) (int, error) {
 	row, col := point.X, point.Y
 
 	if r.StartRow() <= row && row <= r.EndRow() {
-		return int(min(abs(r.StartCol()-col), abs(r.EndCol()-col))) - 1
+		return int(min(abs(r.StartCol()-col), abs(r.EndCol()-col))) - 1, nil
 	}
 	if r.StartCol() <= col && col <= r.EndCol() {
-		return int(min(abs(r.StartRow()-row), abs(r.EndRow()-row))) - 1
+		return int(min(abs(r.StartRow()-row), abs(r.EndRow()-row))) - 1, nil
 	}
-	panic("Cannot calculate distance to point from rectangle")
+	return 0, fmt.Errorf("point (%d, %d) is not aligned with any side of the rectangle", row, col)
 }
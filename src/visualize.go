@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+)
+
+var heatmapColors = []int{17, 19, 27, 33, 39, 45, 118, 190, 226, 214, 208, 202, 196}
+
+func visualizeCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("visualize", flag.ExitOnError)
+	resultsPath := fs.String("results", "", "results CSV file to plot")
+	column := fs.String("column", "conflicts", "column plotted as the color of each cell")
+	fs.Parse(args)
+
+	if *resultsPath == "" {
+		return fmt.Errorf("the -results flag is required")
+	}
+	f, err := os.Open(*resultsPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) < 2 {
+		return fmt.Errorf("%s has no results", *resultsPath)
+	}
+
+	header := records[0]
+	pedestrianCol := slices.Index(header, "pedestrian_arrival_rate")
+	vehicleCol := slices.Index(header, "vehicle_arrival_rate")
+	valueCol := slices.Index(header, *column)
+	if pedestrianCol == -1 || vehicleCol == -1 || valueCol == -1 {
+		return fmt.Errorf("%s must have the pedestrian_arrival_rate, vehicle_arrival_rate and %s columns", *resultsPath, *column)
+	}
+
+	values := make(map[[2]string]float64)
+	pedestrianRates := make([]string, 0)
+	vehicleRates := make([]string, 0)
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, record := range records[1:] {
+		value, err := strconv.ParseFloat(record[valueCol], 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", *column, record[valueCol], err)
+		}
+		pedestrianRate, vehicleRate := record[pedestrianCol], record[vehicleCol]
+		if !slices.Contains(pedestrianRates, pedestrianRate) {
+			pedestrianRates = append(pedestrianRates, pedestrianRate)
+		}
+		if !slices.Contains(vehicleRates, vehicleRate) {
+			vehicleRates = append(vehicleRates, vehicleRate)
+		}
+		values[[2]string{pedestrianRate, vehicleRate}] = value
+		low, high = min(low, value), max(high, value)
+	}
+	sortNumerically(pedestrianRates)
+	sortNumerically(vehicleRates)
+
+	fmt.Printf("%s by vehicle (rows, veh/hr) and pedestrian (columns, cap/hr) arrival rates\n", *column)
+	fmt.Printf("%6s  pedestrian arrival rate from %s to %s\n", "", pedestrianRates[0], pedestrianRates[len(pedestrianRates)-1])
+	for i := len(vehicleRates) - 1; i >= 0; i-- {
+		fmt.Printf("%6s  ", vehicleRates[i])
+		for _, pedestrianRate := range pedestrianRates {
+			value, ok := values[[2]string{pedestrianRate, vehicleRates[i]}]
+			if !ok {
+				fmt.Print("  ")
+				continue
+			}
+			fmt.Printf("\033[48;5;%dm  \033[0m", heatmapColor(value, low, high))
+		}
+		fmt.Println()
+	}
+
+	fmt.Print("\nScale: ")
+	for i, color := range heatmapColors {
+		value := low + (high-low)*float64(i)/float64(len(heatmapColors)-1)
+		fmt.Printf("\033[48;5;%dm  \033[0m %.2f ", color, value)
+	}
+	fmt.Println()
+	return nil
+}
+
+func heatmapColor(value, low, high float64) int {
+	if high == low {
+		return heatmapColors[0]
+	}
+	i := int((value - low) / (high - low) * float64(len(heatmapColors)-1))
+	return heatmapColors[i]
+}
+
+func sortNumerically(values []string) {
+	slices.SortFunc(values, func(a, b string) int {
+		x, _ := strconv.ParseFloat(a, 64)
+		y, _ := strconv.ParseFloat(b, 64)
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	})
+}
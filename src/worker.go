@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go_automata/src/generator"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// workerPollInterval is how long a worker waits before asking again when no
+// configuration is free.
+const workerPollInterval = time.Second
+
+var (
+	errSweepOver = errors.New("the sweep is over")
+	errLeaseLost = errors.New("the lease was lost")
+)
+
+// CoordinatorClient calls the API of a coordinator, see coordinator.go.
+type CoordinatorClient struct {
+	base   string
+	client *http.Client
+}
+
+func NewCoordinatorClient(address string) *CoordinatorClient {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	return &CoordinatorClient{strings.TrimSuffix(address, "/"), &http.Client{Timeout: time.Minute}}
+}
+
+// call sends body, if any, as JSON and returns the response when its status
+// is one of the expected ones.
+func (cc *CoordinatorClient) call(ctx context.Context, method, path string, body any, expected ...int) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, cc.base+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusConflict {
+		return nil, errLeaseLost
+	}
+	message, _ := io.ReadAll(resp.Body)
+	return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(message)))
+}
+
+func (cc *CoordinatorClient) Setup(ctx context.Context) (*WorkerSetup, error) {
+	resp, err := cc.call(ctx, http.MethodGet, "/setup", nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	setup := &WorkerSetup{Scenario: DefaultScenarioConfig()}
+	return setup, yaml.Unmarshal(data, setup)
+}
+
+// Lease returns the next configuration to simulate, nil if none is free yet,
+// or errSweepOver.
+func (cc *CoordinatorClient) Lease(ctx context.Context) (*Lease, error) {
+	resp, err := cc.call(ctx, http.MethodPost, "/leases", nil, http.StatusOK, http.StatusNoContent, http.StatusGone)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil, nil
+	case http.StatusGone:
+		return nil, errSweepOver
+	}
+	l := &Lease{}
+	return l, json.NewDecoder(resp.Body).Decode(l)
+}
+
+func (cc *CoordinatorClient) post(ctx context.Context, id, action string, body any) error {
+	resp, err := cc.call(ctx, http.MethodPost, "/leases/"+id+"/"+action, body, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// leaseRecorder records the replications of a lease with the coordinator.
+type leaseRecorder struct {
+	ctx    context.Context
+	client *CoordinatorClient
+	id     string
+}
+
+func (lr *leaseRecorder) Record(entry *CheckpointEntry) error {
+	return lr.client.post(lr.ctx, lr.id, "replications", entry)
+}
+
+// Worker simulates the configurations leased from a coordinator.
+type Worker struct {
+	client       *CoordinatorClient
+	cfg          *ScenarioConfig
+	newGenerator generator.Factory
+	inputs       []Input
+}
+
+func NewWorker(ctx context.Context, client *CoordinatorClient) (*Worker, error) {
+	setup, err := client.Setup(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cfg := setup.Scenario
+	if errs := cfg.Validate(); len(errs) > 0 {
+		return nil, ConfigErrors(errs)
+	}
+	build := readBuildInfo()
+	if build.Commit != setup.Build.Commit || build.GoVersion != setup.Build.GoVersion {
+		fmt.Printf("Warning: the coordinator runs commit %s built with %s, this worker %s built with %s\n",
+			setup.Build.Commit, setup.Build.GoVersion, build.Commit, build.GoVersion)
+	}
+	newGenerator, err := generator.Lookup(cfg.Replications.Generator)
+	if err != nil {
+		return nil, err
+	}
+	sweep, err := NewSweep(cfg)
+	if err != nil {
+		return nil, err
+	}
+	w := &Worker{client: client, cfg: cfg, newGenerator: newGenerator}
+	configs := sweep.Configs()
+	comparedConfigs := sweep.ComparedConfigs()
+	for i, config := range configs {
+		input := Input{i: uint64(i), config: config}
+		if comparedConfigs != nil {
+			input.compared = comparedConfigs[i]
+		}
+		w.inputs = append(w.inputs, input)
+	}
+	return w, nil
+}
+
+// Work leases configurations and simulates them until the sweep is over or
+// ctx is done. A configuration left unfinished is given to another worker
+// once its lease expires.
+func (w *Worker) Work(ctx context.Context) error {
+	for {
+		l, err := w.client.Lease(ctx)
+		if errors.Is(err, errSweepOver) || ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if l == nil {
+			select {
+			case <-time.After(workerPollInterval):
+			case <-ctx.Done():
+				return nil
+			}
+			continue
+		}
+		if err := w.simulate(ctx, l); err != nil && !errors.Is(err, errLeaseLost) {
+			return err
+		}
+	}
+}
+
+func (w *Worker) simulate(ctx context.Context, l *Lease) error {
+	if l.Index >= uint64(len(w.inputs)) {
+		return fmt.Errorf("leased configuration %d of a sweep of %d", l.Index, len(w.inputs))
+	}
+	input := w.inputs[l.Index]
+	input.done = make(map[uint64]*CheckpointEntry)
+	for _, entry := range l.Done {
+		input.done[entry.Replication] = entry
+	}
+
+	// The heartbeat keeps the lease while the replications run, and stops
+	// them if the lease was lost.
+	leaseCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go func() {
+		interval := time.Duration(l.HeartbeatSeconds * float64(time.Second))
+		for {
+			select {
+			case <-time.After(interval):
+			case <-leaseCtx.Done():
+				return
+			}
+			if err := w.client.post(leaseCtx, l.ID, "heartbeat", nil); err != nil && leaseCtx.Err() == nil {
+				cancel(err)
+				return
+			}
+		}
+	}()
+
+	_, err := simulateConfiguration(leaseCtx, w.cfg, input, w.newGenerator, &leaseRecorder{leaseCtx, w.client, l.ID})
+	if ctx.Err() != nil {
+		return nil
+	}
+	if cause := context.Cause(leaseCtx); cause != nil {
+		return cause
+	}
+	if errors.Is(err, errLeaseLost) {
+		return err
+	}
+	done := LeaseDone{}
+	if err != nil {
+		done.Error = err.Error()
+		fmt.Println("Configuration", l.Index, "abandoned:", err)
+	} else {
+		fmt.Println("Configuration", l.Index, "finished")
+	}
+	return w.client.post(ctx, l.ID, "done", done)
+}
+
+func workerCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	address := fs.String("coordinator", "localhost:8080", "address of the coordinator, a 'sweep -listen'")
+	goroutines := fs.Int("goroutines", runtime.NumCPU(), "configurations simulated at once")
+	fs.Parse(args)
+
+	worker, err := NewWorker(ctx, NewCoordinatorClient(*address))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Working on a sweep of %d configurations with %d goroutines\n", len(worker.inputs), *goroutines)
+
+	var wg sync.WaitGroup
+	errs := make([]error, *goroutines)
+	for k := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[k] = worker.Work(ctx)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}